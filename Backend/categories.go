@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Category is a node in the listing category taxonomy.
+type Category struct {
+	ID           int         `json:"id"`
+	ParentID     *int        `json:"parentId"`
+	Slug         string      `json:"slug"`
+	Name         string      `json:"name"`
+	DisplayOrder int         `json:"displayOrder"`
+	Children     []*Category `json:"children"`
+}
+
+// categorySeed describes a built-in category. Aliases are the free-text
+// values that the migration maps onto the category.
+type categorySeed struct {
+	Slug    string
+	Name    string
+	Parent  string
+	Aliases []string
+}
+
+// otherCategory catches free-text values that match nothing else.
+const otherCategory = "other"
+
+// defaultCategories is the built-in taxonomy. Parents must come before their children.
+var defaultCategories = []categorySeed{
+	{Slug: "books", Name: "Books", Aliases: []string{"book"}},
+	{Slug: "textbooks", Name: "Textbooks", Parent: "books", Aliases: []string{"textbook", "course books", "coursebook"}},
+	{Slug: "novels", Name: "Novels", Parent: "books", Aliases: []string{"novel", "fiction"}},
+	{Slug: "electronics", Name: "Electronics", Aliases: []string{"electronic", "tech", "gadgets"}},
+	{Slug: "computers", Name: "Computers & Laptops", Parent: "electronics", Aliases: []string{"computer", "laptop", "laptops", "pc", "macbook"}},
+	{Slug: "phones", Name: "Phones & Tablets", Parent: "electronics", Aliases: []string{"phone", "mobile", "tablet", "ipad", "iphone"}},
+	{Slug: "audio", Name: "Audio", Parent: "electronics", Aliases: []string{"headphones", "speakers", "speaker"}},
+	{Slug: "furniture", Name: "Furniture", Aliases: []string{"furnitures"}},
+	{Slug: "desks-chairs", Name: "Desks & Chairs", Parent: "furniture", Aliases: []string{"desk", "chair", "chairs", "desks"}},
+	{Slug: "beds-mattresses", Name: "Beds & Mattresses", Parent: "furniture", Aliases: []string{"bed", "mattress"}},
+	{Slug: "storage", Name: "Storage", Parent: "furniture", Aliases: []string{"shelf", "shelves", "drawers"}},
+	{Slug: "clothing", Name: "Clothing", Aliases: []string{"clothes", "apparel", "fashion"}},
+	{Slug: "shoes", Name: "Shoes", Parent: "clothing", Aliases: []string{"shoe", "sneakers"}},
+	{Slug: "home-kitchen", Name: "Home & Kitchen", Aliases: []string{"home", "kitchen", "household"}},
+	{Slug: "appliances", Name: "Appliances", Parent: "home-kitchen", Aliases: []string{"appliance", "fridge", "mini fridge", "microwave"}},
+	{Slug: "sports-outdoors", Name: "Sports & Outdoors", Aliases: []string{"sports", "sport", "outdoors", "fitness", "sports and fitness"}},
+	{Slug: "vehicles", Name: "Bikes & Vehicles", Aliases: []string{"bike", "bikes", "bicycle", "scooter", "car", "automotive"}},
+	{Slug: "beauty-personal-care", Name: "Beauty & Personal Care", Aliases: []string{"beauty", "personal care", "cosmetics", "makeup"}},
+	{Slug: "health-wellness", Name: "Health & Wellness", Aliases: []string{"health", "wellness"}},
+	{Slug: "toys-games", Name: "Toys & Games", Aliases: []string{"toy", "toys", "games", "board games"}},
+	{Slug: "baby", Name: "Baby Products", Aliases: []string{"baby products", "baby gear"}},
+	{Slug: "pet-supplies", Name: "Pet Supplies", Aliases: []string{"pet", "pets", "pet supplies"}},
+	{Slug: "food-beverages", Name: "Food & Beverages", Aliases: []string{"food", "beverages", "drinks", "snacks"}},
+	{Slug: "tools-hardware", Name: "DIY & Hardware", Aliases: []string{"diy", "hardware", "tools"}},
+	{Slug: "arts-crafts", Name: "Arts & Crafts", Aliases: []string{"art", "arts", "crafts", "art supplies"}},
+	{Slug: "office-supplies", Name: "Office Supplies", Aliases: []string{"office", "school supplies", "stationery"}},
+	{Slug: "music-instruments", Name: "Music & Instruments", Aliases: []string{"music", "instrument", "instruments", "musical instruments"}},
+	{Slug: "garden-outdoor", Name: "Garden & Outdoor", Aliases: []string{"garden", "gardening", "plants"}},
+	{Slug: otherCategory, Name: "Other", Aliases: []string{"misc", "miscellaneous"}},
+}
+
+// categorySubtreeSQL selects the slug bound to $%d and the slugs of all of its
+// descendants. It is meant to be passed to listingQuery.where.
+const categorySubtreeSQL = "WITH RECURSIVE subtree AS (" +
+	"SELECT id, slug FROM categories WHERE slug = $%d " +
+	"UNION ALL SELECT child.id, child.slug FROM categories child JOIN subtree ON child.parent_id = subtree.id" +
+	") SELECT slug FROM subtree"
+
+// initCategoriesDB creates and seeds the categories table, maps existing
+// free-text listing categories onto it, and then enforces the mapping with
+// a foreign key. It must run after initListingsDB.
+func initCategoriesDB() error {
+	categoriesTable := `
+	CREATE TABLE IF NOT EXISTS categories (
+		id SERIAL PRIMARY KEY,
+		parent_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+		slug TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		display_order INTEGER NOT NULL DEFAULT 0
+	);`
+	if _, err := db.Exec(categoriesTable); err != nil {
+		return fmt.Errorf("error creating categories table: %v", err)
+	}
+
+	for i, c := range defaultCategories {
+		var parent interface{}
+		if c.Parent != "" {
+			parent = c.Parent
+		}
+		_, err := db.Exec(
+			`INSERT INTO categories(parent_id, slug, name, display_order)
+			VALUES((SELECT id FROM categories WHERE slug = $1), $2, $3, $4)
+			ON CONFLICT (slug) DO NOTHING`,
+			parent, c.Slug, c.Name, i,
+		)
+		if err != nil {
+			return fmt.Errorf("error seeding category %s: %v", c.Slug, err)
+		}
+	}
+
+	if err := migrateListingCategories(); err != nil {
+		return fmt.Errorf("error migrating listing categories: %v", err)
+	}
+
+	categoryForeignKey := `
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'listings_category_fkey') THEN
+			ALTER TABLE listings ADD CONSTRAINT listings_category_fkey
+				FOREIGN KEY (category) REFERENCES categories(slug) ON UPDATE CASCADE;
+		END IF;
+	END $$;`
+	if _, err := db.Exec(categoryForeignKey); err != nil {
+		return fmt.Errorf("error adding listings category foreign key: %v", err)
+	}
+	return nil
+}
+
+// migrateListingCategories rewrites every listing category that is not yet
+// a known slug to the best matching slug, falling back to otherCategory.
+func migrateListingCategories() error {
+	rows, err := db.Query(
+		"SELECT DISTINCT COALESCE(category, '') FROM listings WHERE category IS NULL OR category NOT IN (SELECT slug FROM categories)")
+	if err != nil {
+		return err
+	}
+	var legacy []string
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, raw)
+	}
+	rows.Close()
+
+	for _, raw := range legacy {
+		slug := matchCategorySeed(raw)
+		if _, err := db.Exec(
+			"UPDATE listings SET category = $1 WHERE COALESCE(category, '') = $2", slug, raw,
+		); err != nil {
+			return err
+		}
+		log.Printf("Mapped listing category %q to %q", raw, slug)
+	}
+	return nil
+}
+
+// normalizeCategoryKey lowercases s and drops everything except letters and
+// digits, so "Text-Book", "textbook" and " TEXTBOOK " compare equal. The
+// word "and" is dropped too, so "Home and Kitchen" matches "Home & Kitchen".
+func normalizeCategoryKey(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if w != "and" {
+			b.WriteString(w)
+		}
+	}
+	return b.String()
+}
+
+// matchCategoryAlias maps a free-text category onto a seed slug by slug,
+// name or alias.
+func matchCategoryAlias(raw string) (string, bool) {
+	key := normalizeCategoryKey(raw)
+	if key == "" {
+		return "", false
+	}
+	// Also try the singular form, so "Chairs" matches the "chair" alias.
+	singular := strings.TrimSuffix(key, "s")
+	for _, c := range defaultCategories {
+		candidates := append([]string{c.Slug, c.Name}, c.Aliases...)
+		for _, candidate := range candidates {
+			k := normalizeCategoryKey(candidate)
+			if k == key || k == singular {
+				return c.Slug, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchCategorySeed is matchCategoryAlias falling back to otherCategory.
+func matchCategorySeed(raw string) string {
+	if slug, ok := matchCategoryAlias(raw); ok {
+		return slug
+	}
+	return otherCategory
+}
+
+// errUnknownCategory is returned by resolveCategory for values not in the taxonomy.
+var errUnknownCategory = errors.New("unknown category")
+
+// resolveCategory validates a category submitted with a listing and returns
+// its slug. It accepts the slug or the display name, case-insensitively, or
+// a built-in alias such as the names the sell form offers.
+var resolveCategory = func(input string) (string, error) {
+	var slug string
+	err := db.QueryRow(
+		"SELECT slug FROM categories WHERE lower(slug) = lower($1) OR lower(name) = lower($1) LIMIT 1",
+		strings.TrimSpace(input),
+	).Scan(&slug)
+	if err == sql.ErrNoRows {
+		if alias, ok := matchCategoryAlias(input); ok {
+			return alias, nil
+		}
+		return "", fmt.Errorf("%w %q", errUnknownCategory, input)
+	}
+	return slug, err
+}
+
+// getCategories returns every category ordered for display.
+var getCategories = func() ([]Category, error) {
+	rows, err := db.Query("SELECT id, parent_id, slug, name, display_order FROM categories ORDER BY display_order, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		var parentID sql.NullInt64
+		if err := rows.Scan(&c.ID, &parentID, &c.Slug, &c.Name, &c.DisplayOrder); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			c.ParentID = &id
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// buildCategoryTree nests a flat category list under its parents. Siblings
+// keep the display order of the input.
+func buildCategoryTree(flat []Category) []*Category {
+	nodes := make(map[int]*Category, len(flat))
+	for i := range flat {
+		c := flat[i]
+		c.Children = []*Category{}
+		nodes[c.ID] = &c
+	}
+
+	roots := []*Category{}
+	for i := range flat {
+		node := nodes[flat[i].ID]
+		if node.ParentID != nil {
+			if parent, ok := nodes[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	var sortNodes func([]*Category)
+	sortNodes = func(list []*Category) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].DisplayOrder < list[j].DisplayOrder })
+		for _, n := range list {
+			sortNodes(n.Children)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
+
+// categoriesHandler handles GET /categories and returns the taxonomy as a tree.
+func categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := getCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildCategoryTree(categories))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchCategorySeed(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Books", "books"},
+		{"books", "books"},
+		{"Textbook", "textbooks"},
+		{"TEXT-BOOKS", "textbooks"},
+		{"Laptops", "computers"},
+		{"Chairs", "desks-chairs"},
+		{"Mini Fridge", "appliances"},
+		{"Home & Kitchen", "home-kitchen"},
+		{"Home and Kitchen", "home-kitchen"},
+		{"Sports and Fitness", "sports-outdoors"},
+		{"Automotive", "vehicles"},
+		{"Band merch", otherCategory},
+		{"", otherCategory},
+		{"Spaceships", otherCategory},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchCategorySeed(tt.raw), tt.raw)
+	}
+}
+
+func TestSellFormCategoriesResolve(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	// The category names offered by Frontend/src/sell/Sell.tsx.
+	sellForm := []string{
+		"Electronics", "Books", "Furniture", "Clothing", "Beauty and Personal Care",
+		"Sports and Fitness", "Toys and Games", "Home and Kitchen", "Health and Wellness",
+		"Baby Products", "Pet Supplies", "Food and Beverages", "Automotive", "DIY and Hardware",
+		"Arts and Crafts", "Office Supplies", "Music and Instruments", "Garden and Outdoor",
+	}
+	for _, name := range sellForm {
+		mock.ExpectQuery("SELECT slug FROM categories").WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+		slug, err := resolveCategory(name)
+		assert.NoError(t, err, name)
+		assert.NotEqual(t, otherCategory, slug, name)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDefaultCategoriesParentsComeFirst(t *testing.T) {
+	seen := map[string]bool{}
+	for _, c := range defaultCategories {
+		if c.Parent != "" {
+			assert.True(t, seen[c.Parent], "parent %s of %s must be seeded first", c.Parent, c.Slug)
+		}
+		assert.False(t, seen[c.Slug], "duplicate slug %s", c.Slug)
+		seen[c.Slug] = true
+	}
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	one, two := 1, 2
+	flat := []Category{
+		{ID: 2, Slug: "electronics", DisplayOrder: 1},
+		{ID: 1, Slug: "books", DisplayOrder: 0},
+		{ID: 4, ParentID: &two, Slug: "phones", DisplayOrder: 4},
+		{ID: 3, ParentID: &one, Slug: "textbooks", DisplayOrder: 2},
+		{ID: 5, ParentID: &two, Slug: "computers", DisplayOrder: 3},
+	}
+
+	tree := buildCategoryTree(flat)
+
+	assert.Len(t, tree, 2)
+	assert.Equal(t, "books", tree[0].Slug)
+	assert.Equal(t, "textbooks", tree[0].Children[0].Slug)
+	assert.Equal(t, "electronics", tree[1].Slug)
+	assert.Equal(t, []string{"computers", "phones"}, []string{tree[1].Children[0].Slug, tree[1].Children[1].Slug})
+}
+
+func TestCategoriesHandler(t *testing.T) {
+	originalGetCategories := getCategories
+	defer func() { getCategories = originalGetCategories }()
+	one := 1
+	getCategories = func() ([]Category, error) {
+		return []Category{{ID: 1, Slug: "books", Name: "Books"}, {ID: 2, ParentID: &one, Slug: "textbooks", Name: "Textbooks"}}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/categories", nil)
+	w := httptest.NewRecorder()
+	categoriesHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tree []Category
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Len(t, tree, 1)
+	assert.Len(t, tree[0].Children, 1)
+}
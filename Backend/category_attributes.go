@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Attribute value types.
+const (
+	AttributeText    = "text"
+	AttributeNumber  = "number"
+	AttributeEnum    = "enum"
+	AttributeBoolean = "boolean"
+)
+
+// CategoryAttribute defines a structured field that listings in a category
+// (and its subcategories) can carry. Attributes without a category apply to
+// every listing.
+type CategoryAttribute struct {
+	Name          string   `json:"name"`
+	Label         string   `json:"label"`
+	Type          string   `json:"type"`
+	Required      bool     `json:"required"`
+	AllowedValues []string `json:"allowedValues,omitempty"`
+}
+
+// attributeSeed attaches a CategoryAttribute to a category slug. An empty
+// slug makes the attribute global.
+type attributeSeed struct {
+	Category string
+	CategoryAttribute
+}
+
+var defaultCategoryAttributes = []attributeSeed{
+	// condition is optional so that listings created before attributes existed stay valid.
+	{"", CategoryAttribute{Name: "condition", Label: "Condition", Type: AttributeEnum,
+		AllowedValues: []string{"new", "like-new", "good", "fair", "poor"}}},
+	{"clothing", CategoryAttribute{Name: "size", Label: "Size", Type: AttributeText}},
+	{"electronics", CategoryAttribute{Name: "brand", Label: "Brand", Type: AttributeText}},
+	{"electronics", CategoryAttribute{Name: "model", Label: "Model", Type: AttributeText}},
+	{"books", CategoryAttribute{Name: "isbn", Label: "ISBN", Type: AttributeText}},
+	{"books", CategoryAttribute{Name: "edition", Label: "Edition", Type: AttributeText}},
+}
+
+// maxAttributeTextLength caps free-text attribute values.
+const maxAttributeTextLength = 200
+
+// attributeNamePattern restricts the attribute names accepted in feed filters.
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// initCategoryAttributesDB creates and seeds the category_attributes table
+// and adds the listings.attributes JSONB column. It must run after initCategoriesDB.
+func initCategoryAttributesDB() error {
+	attributesTable := `
+	CREATE TABLE IF NOT EXISTS category_attributes (
+		id SERIAL PRIMARY KEY,
+		category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		label TEXT NOT NULL,
+		type TEXT NOT NULL CHECK (type IN ('text', 'number', 'enum', 'boolean')),
+		required BOOLEAN NOT NULL DEFAULT FALSE,
+		allowed_values TEXT[] NOT NULL DEFAULT '{}',
+		display_order INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_category_attributes_name ON category_attributes ((COALESCE(category_id, 0)), name);
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+	CREATE INDEX IF NOT EXISTS idx_listings_attributes ON listings USING GIN (attributes);`
+	if _, err := db.Exec(attributesTable); err != nil {
+		return fmt.Errorf("error creating category_attributes table: %v", err)
+	}
+
+	for i, a := range defaultCategoryAttributes {
+		var category interface{}
+		if a.Category != "" {
+			category = a.Category
+		}
+		_, err := db.Exec(
+			`INSERT INTO category_attributes(category_id, name, label, type, required, allowed_values, display_order)
+			VALUES((SELECT id FROM categories WHERE slug = $1), $2, $3, $4, $5, $6, $7)
+			ON CONFLICT ((COALESCE(category_id, 0)), name) DO NOTHING`,
+			category, a.Name, a.Label, a.Type, a.Required, pq.Array(a.AllowedValues), i,
+		)
+		if err != nil {
+			return fmt.Errorf("error seeding attribute %s: %v", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// getCategoryAttributes returns the attributes that apply to a category:
+// global ones plus those attached to the category or any of its ancestors.
+var getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) {
+	rows, err := db.Query(`
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id FROM categories WHERE slug = $1
+		UNION ALL
+		SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+	)
+	SELECT name, label, type, required, allowed_values
+	FROM category_attributes
+	WHERE category_id IS NULL OR category_id IN (SELECT id FROM ancestors)
+	ORDER BY display_order, name`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := []CategoryAttribute{}
+	for rows.Next() {
+		var a CategoryAttribute
+		var allowed pq.StringArray
+		if err := rows.Scan(&a.Name, &a.Label, &a.Type, &a.Required, &allowed); err != nil {
+			return nil, err
+		}
+		a.AllowedValues = allowed
+		attributes = append(attributes, a)
+	}
+	return attributes, rows.Err()
+}
+
+// parseAttributesField decodes the JSON object sent in the attributes form field.
+func parseAttributesField(raw string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if strings.TrimSpace(raw) == "" {
+		return values, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("attributes must be a JSON object")
+	}
+	return values, nil
+}
+
+// validateListingAttributes checks values against the attribute definitions
+// for the listing's category and returns them normalized to their declared
+// types. Unknown attributes and missing required ones are rejected.
+func validateListingAttributes(defs []CategoryAttribute, values map[string]interface{}) (map[string]interface{}, error) {
+	byName := make(map[string]CategoryAttribute, len(defs))
+	for _, d := range defs {
+		byName[d.Name] = d
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	normalized := make(map[string]interface{}, len(values))
+	for _, name := range names {
+		def, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %q for this category", name)
+		}
+		v, err := normalizeAttributeValue(def, values[name])
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			normalized[name] = v
+		}
+	}
+
+	for _, d := range defs {
+		if _, ok := normalized[d.Name]; d.Required && !ok {
+			return nil, fmt.Errorf("attribute %q is required", d.Name)
+		}
+	}
+	return normalized, nil
+}
+
+// normalizeAttributeValue converts a decoded JSON value to the attribute's
+// type. Empty values are returned as nil and dropped by the caller.
+func normalizeAttributeValue(def CategoryAttribute, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if s, ok := value.(string); ok {
+		value = strings.TrimSpace(s)
+		if value == "" {
+			return nil, nil
+		}
+	}
+
+	switch def.Type {
+	case AttributeText:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("attribute %q must be text", def.Name)
+		}
+		if len(s) > maxAttributeTextLength {
+			return nil, fmt.Errorf("attribute %q is too long", def.Name)
+		}
+		return s, nil
+
+	case AttributeNumber:
+		var raw string
+		switch v := value.(type) {
+		case float64:
+			// Values read back from the database are already numbers.
+			return v, nil
+		case json.Number:
+			raw = v.String()
+		case string:
+			raw = v
+		default:
+			return nil, fmt.Errorf("attribute %q must be a number", def.Name)
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q must be a number", def.Name)
+		}
+		return n, nil
+
+	case AttributeEnum:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("attribute %q must be one of %s", def.Name, strings.Join(def.AllowedValues, ", "))
+		}
+		for _, allowed := range def.AllowedValues {
+			if strings.EqualFold(s, allowed) {
+				return allowed, nil
+			}
+		}
+		return nil, fmt.Errorf("attribute %q must be one of %s", def.Name, strings.Join(def.AllowedValues, ", "))
+
+	case AttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("attribute %q must be true or false", def.Name)
+	}
+	return nil, fmt.Errorf("attribute %q has unsupported type %q", def.Name, def.Type)
+}
+
+// resolveListingAttributes validates the raw attributes form field for a
+// listing in the given category and returns the JSON to store.
+func resolveListingAttributes(category, raw string) ([]byte, error) {
+	values, err := parseAttributesField(raw)
+	if err != nil {
+		return nil, err
+	}
+	return revalidateListingAttributes(category, values)
+}
+
+// revalidateListingAttributes validates already-decoded attribute values
+// against the given category and returns the JSON to store.
+func revalidateListingAttributes(category string, values map[string]interface{}) ([]byte, error) {
+	defs, err := getCategoryAttributes(category)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := validateListingAttributes(defs, values)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(normalized)
+}
+
+// categoryAttributesHandler handles GET /categories/{slug}/attributes and
+// returns the attribute schema a listing in that category must follow.
+func categoryAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slug, err := resolveCategory(r.PathValue("slug"))
+	if err != nil {
+		if errors.Is(err, errUnknownCategory) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attributes, err := getCategoryAttributes(slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attributes)
+}
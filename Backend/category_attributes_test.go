@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testAttributeDefs = []CategoryAttribute{
+	{Name: "condition", Type: AttributeEnum, Required: true, AllowedValues: []string{"new", "good", "fair"}},
+	{Name: "isbn", Type: AttributeText},
+	{Name: "pages", Type: AttributeNumber},
+	{Name: "signed", Type: AttributeBoolean},
+}
+
+func TestValidateListingAttributes(t *testing.T) {
+	values, err := parseAttributesField(`{"condition":"Good","isbn":" 978-0134190440 ","pages":"350","signed":true}`)
+	assert.NoError(t, err)
+
+	normalized, err := validateListingAttributes(testAttributeDefs, values)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"condition": "good",
+		"isbn":      "978-0134190440",
+		"pages":     350.0,
+		"signed":    true,
+	}, normalized)
+}
+
+func TestValidateListingAttributesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"Missing required", `{"isbn":"123"}`},
+		{"Blank required", `{"condition":"  "}`},
+		{"Unknown attribute", `{"condition":"new","color":"red"}`},
+		{"Value not allowed", `{"condition":"broken"}`},
+		{"Bad number", `{"condition":"new","pages":"many"}`},
+		{"Bad boolean", `{"condition":"new","signed":"maybe"}`},
+		{"Text given a number", `{"condition":"new","isbn":123}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseAttributesField(tt.raw)
+			assert.NoError(t, err)
+			_, err = validateListingAttributes(testAttributeDefs, values)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseAttributesField(t *testing.T) {
+	values, err := parseAttributesField("")
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	_, err = parseAttributesField(`["not", "an", "object"]`)
+	assert.Error(t, err)
+}
+
+func TestParseListingFilterAttributes(t *testing.T) {
+	f, err := parseListingFilter(url.Values{"attr.condition": {"new"}, "attr.brand": {"Dell"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"condition": "new", "brand": "Dell"}, f.Attributes)
+
+	q := &listingQuery{}
+	f.apply(q)
+	query, params := q.build("SELECT l.id FROM listings l", 0)
+	assert.Contains(t, query, "l.attributes ->> $1 = $2 AND l.attributes ->> $3 = $4")
+	assert.Equal(t, []interface{}{"brand", "Dell", "condition", "new"}, params[:4])
+
+	_, err = parseListingFilter(url.Values{"attr.bad-name": {"x"}})
+	assert.Error(t, err)
+}
@@ -27,6 +27,12 @@ CREATE TABLE IF NOT EXISTS users (
 		return fmt.Errorf("error creating users table: %v", err)
 	}
 
+	// role is one of RoleUser, RoleModerator or RoleAdmin.
+	roleColumn := `ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';`
+	if _, err := db.Exec(roleColumn); err != nil {
+		return fmt.Errorf("error adding users role column: %v", err)
+	}
+
 	sessionsTable := `
 	CREATE TABLE IF NOT EXISTS sessions (
 		session_id TEXT PRIMARY KEY,
@@ -98,6 +104,21 @@ var GetUserInfo = func(userId int) (int, string, string, string, int, string, st
 }
 
 
+// User roles. Moderators and admins get access to moderation and audit endpoints.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// GetUserRole returns the role of the given user.
+var GetUserRole = func(userID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	return role, err
+}
+
+
 // generateSessionID creates a cryptographically secure random session token.
 func generateSessionID() (string, error) {
 	token := make([]byte, 32)
@@ -133,7 +154,7 @@ func initListingsDB() error {
 		user_id INTEGER NOT NULL,
 		product_name TEXT NOT NULL,
 		product_description TEXT,
-		price NUMERIC NOT NULL,
+		price NUMERIC(12,2) NOT NULL CHECK (price >= 0),
 		category TEXT,
 		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
@@ -154,6 +175,41 @@ func initListingsDB() error {
 	if _, err := db.Exec(imagesTable); err != nil {
 		return fmt.Errorf("error creating listing_images table: %v", err)
 	}
+
+	// Listing lifecycle: draft -> active -> reserved -> sold, active -> archived.
+	// The check constraint is recreated so that new statuses apply to existing tables.
+	statusColumn := `
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+	ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_status_check;
+	ALTER TABLE listings ADD CONSTRAINT listings_status_check
+		CHECK (status IN ('draft', 'active', 'reserved', 'sold', 'archived'));
+	CREATE INDEX IF NOT EXISTS idx_listings_status ON listings (status);`
+	if _, err := db.Exec(statusColumn); err != nil {
+		return fmt.Errorf("error adding listings status column: %v", err)
+	}
+
+	// Indexes backing keyset pagination and feed filters.
+	listingsIndexes := `
+	CREATE INDEX IF NOT EXISTS idx_listings_created_at_id ON listings (created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_listings_user_created_at_id ON listings (user_id, created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_listings_price_id ON listings (price, id);
+	CREATE INDEX IF NOT EXISTS idx_listings_category ON listings (category);`
+	if _, err := db.Exec(listingsIndexes); err != nil {
+		return fmt.Errorf("error creating listings indexes: %v", err)
+	}
+
+	// Full-text search over product name and description, plus seller names.
+	searchSchema := `
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(product_name, '')), 'A') ||
+			setweight(to_tsvector('english', COALESCE(product_description, '')), 'B')
+		) STORED;
+	CREATE INDEX IF NOT EXISTS idx_listings_search_vector ON listings USING GIN (search_vector);
+	CREATE INDEX IF NOT EXISTS idx_users_name_tsv ON users USING GIN (to_tsvector('simple', name));`
+	if _, err := db.Exec(searchSchema); err != nil {
+		return fmt.Errorf("error creating listings search index: %v", err)
+	}
 	return nil
 }
 
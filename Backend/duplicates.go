@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Duplicate detection thresholds.
+const (
+	defaultDuplicateWindowDays = 14
+	// duplicateTitleSimilarity is the title similarity, from 0 to 1, above
+	// which two listings from the same seller are compared on price.
+	duplicateTitleSimilarity = 0.8
+	// duplicatePriceTolerance is how far apart, as a fraction of the higher
+	// price, two prices may be and still count as the same.
+	duplicatePriceTolerance = 0.1
+)
+
+// duplicateWindow is how far back new listings are compared against other
+// sellers' listings.
+func duplicateWindow() time.Duration {
+	days := appConfig.Listings.DuplicateWindowDays
+	if days <= 0 {
+		days = defaultDuplicateWindowDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// initDuplicatesDB adds content_hash to listing_images, the SHA-256 of the
+// image bytes. It is a generated column, so existing images are hashed by
+// the migration and new ones on insert.
+func initDuplicatesDB() error {
+	duplicatesSchema := `
+	ALTER TABLE listing_images ADD COLUMN IF NOT EXISTS content_hash TEXT GENERATED ALWAYS AS (encode(sha256(image_data), 'hex')) STORED;
+	CREATE INDEX IF NOT EXISTS idx_listing_images_content_hash ON listing_images (content_hash);`
+	if _, err := db.Exec(duplicatesSchema); err != nil {
+		return fmt.Errorf("error adding image content hashes: %v", err)
+	}
+	return nil
+}
+
+// imageContentHash returns the same hash as listing_images.content_hash.
+func imageContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// listingImage is an uploaded image that has not been saved yet.
+type listingImage struct {
+	Data        []byte
+	ContentType string
+}
+
+// normalizeTitle lower-cases a title, drops punctuation and sorts its words,
+// so "IKEA Desk-Lamp!" and "desk lamp ikea" normalize the same.
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// titleSimilarity is the Dice coefficient of the character bigrams of two
+// normalized titles: 1 for the same title and 0 for titles sharing no
+// bigrams. It tolerates small typos and reordered words.
+func titleSimilarity(a, b string) float64 {
+	a, b = normalizeTitle(a), normalizeTitle(b)
+	if a == b {
+		return 1
+	}
+	bigrams := func(s string) map[string]int {
+		runes := []rune(s)
+		counts := map[string]int{}
+		for i := 0; i+1 < len(runes); i++ {
+			counts[string(runes[i:i+2])]++
+		}
+		return counts
+	}
+	ba, bb := bigrams(a), bigrams(b)
+	var total, shared int
+	for g, n := range ba {
+		total += n
+		if m := bb[g]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	for _, n := range bb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// pricesClose reports whether two prices are within duplicatePriceTolerance
+// of each other.
+func pricesClose(a, b Money) bool {
+	high, low := a, b
+	if low > high {
+		high, low = low, high
+	}
+	return float64(high-low) <= float64(high)*duplicatePriceTolerance
+}
+
+// duplicateCandidate is an existing listing a new one is compared against.
+// SameImage is set when it has an image identical to one being uploaded.
+type duplicateCandidate struct {
+	ID          int
+	UserID      int
+	ProductName string
+	Price       Money
+	SameImage   bool
+}
+
+// findDuplicateCandidates returns the seller's active and reserved listings,
+// and other sellers' listings created since the given time that share an
+// image with the upload.
+var findDuplicateCandidates = func(userID int, since time.Time, imageHashes []string) ([]duplicateCandidate, error) {
+	rows, err := db.Query(
+		`SELECT l.id, l.user_id, l.product_name, l.price,
+			EXISTS (SELECT 1 FROM listing_images i WHERE i.listing_id = l.id AND i.content_hash = ANY($4)) AS same_image
+		FROM listings l
+		WHERE l.deleted_at IS NULL AND l.status = ANY($3)
+			AND (l.user_id = $1 OR (l.created_at >= $2
+				AND EXISTS (SELECT 1 FROM listing_images i WHERE i.listing_id = l.id AND i.content_hash = ANY($4))))
+		ORDER BY l.created_at DESC, l.id DESC`,
+		userID, since, pq.Array(publicListingStatuses), pq.Array(imageHashes),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []duplicateCandidate
+	for rows.Next() {
+		var c duplicateCandidate
+		if err := rows.Scan(&c.ID, &c.UserID, &c.ProductName, &c.Price, &c.SameImage); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// DuplicateMatch is an existing listing that a new listing duplicates.
+// Merged is set when the new listing was merged into it.
+type DuplicateMatch struct {
+	ListingID  int      `json:"existingListingId"`
+	SameSeller bool     `json:"sameSeller"`
+	Reasons    []string `json:"reasons"`
+	Merged     bool     `json:"merged"`
+}
+
+// matchDuplicate returns the candidate a new listing most likely duplicates,
+// or nil. A shared image is a duplicate whoever posted it. A similar title
+// at a similar price is only a duplicate from the same seller, since
+// different sellers often have the same item at the same price.
+func matchDuplicate(userID int, name string, price Money, candidates []duplicateCandidate) *DuplicateMatch {
+	var best *DuplicateMatch
+	bestScore := 0.0
+	for _, c := range candidates {
+		sameSeller := c.UserID == userID
+		similarity := titleSimilarity(name, c.ProductName)
+		var reasons []string
+		if c.SameImage {
+			reasons = append(reasons, "uses the same photo")
+		}
+		if sameSeller && similarity >= duplicateTitleSimilarity && pricesClose(price, c.Price) {
+			reasons = append(reasons, "has a similar title and price")
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		// Shared photos outrank title matches; ties go to the closer title.
+		score := similarity
+		if c.SameImage {
+			score += 1
+		}
+		if best == nil || score > bestScore {
+			best = &DuplicateMatch{ListingID: c.ID, SameSeller: sameSeller, Reasons: reasons}
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// findDuplicateListing compares a new listing against existing ones.
+func findDuplicateListing(userID int, name string, price Money, images []listingImage) (*DuplicateMatch, error) {
+	hashes := make([]string, len(images))
+	for i, img := range images {
+		hashes[i] = imageContentHash(img.Data)
+	}
+	candidates, err := findDuplicateCandidates(userID, time.Now().Add(-duplicateWindow()), hashes)
+	if err != nil {
+		return nil, err
+	}
+	return matchDuplicate(userID, name, price, candidates), nil
+}
+
+// getListingImageHashes returns the content hashes of a listing's images.
+var getListingImageHashes = func(listingID int) ([]string, error) {
+	rows, err := db.Query("SELECT content_hash FROM listing_images WHERE listing_id = $1", listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// findDuplicateOfListing compares a saved listing, such as a draft being
+// published, against the other public listings.
+func findDuplicateOfListing(l Listing) (*DuplicateMatch, error) {
+	hashes, err := getListingImageHashes(l.ID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := findDuplicateCandidates(l.UserID, time.Now().Add(-duplicateWindow()), hashes)
+	if err != nil {
+		return nil, err
+	}
+	others := candidates[:0]
+	for _, c := range candidates {
+		if c.ID != l.ID {
+			others = append(others, c)
+		}
+	}
+	return matchDuplicate(l.UserID, l.ProductName, l.Price, others), nil
+}
+
+// writeDuplicateConflict rejects a listing that duplicates an existing one.
+func writeDuplicateConflict(w http.ResponseWriter, duplicate *DuplicateMatch) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           fmt.Sprintf("This looks like a duplicate of listing %d: it %s", duplicate.ListingID, strings.Join(duplicate.Reasons, " and ")),
+		"existingListingId": duplicate.ListingID,
+		"sameSeller":        duplicate.SameSeller,
+		"reasons":           duplicate.Reasons,
+	})
+}
+
+// mergeDuplicateListing merges a new listing into the seller's existing one
+// by adding the images it does not have yet, up to maxListingImages. The
+// existing listing's expiry is left alone; sellers renew it explicitly.
+var mergeDuplicateListing = func(listingID int, images []listingImage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the listing so concurrent merges cannot both fill the last slots.
+	if _, err := tx.Exec("SELECT id FROM listings WHERE id = $1 FOR UPDATE", listingID); err != nil {
+		return err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM listing_images WHERE listing_id = $1", listingID).Scan(&count); err != nil {
+		return err
+	}
+	added := 0
+	for _, img := range images {
+		if count >= maxListingImages {
+			break
+		}
+		res, err := tx.Exec(
+			`INSERT INTO listing_images(listing_id, image_data, content_type)
+			SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM listing_images WHERE listing_id = $1 AND content_hash = $4)`,
+			listingID, img.Data, img.ContentType, imageContentHash(img.Data),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			count++
+			added++
+		}
+	}
+	if added > 0 {
+		if _, err := tx.Exec("UPDATE listings SET updated_at = $1 WHERE id = $2", time.Now(), listingID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitleSimilarity(t *testing.T) {
+	assert.Equal(t, "desk ikea lamp", normalizeTitle("IKEA Desk-Lamp!"))
+	assert.Equal(t, 1.0, titleSimilarity("IKEA desk lamp", "desk lamp, IKEA"))
+	assert.GreaterOrEqual(t, titleSimilarity("TI-84 Plus calculator", "TI 84 Plus calculater"), duplicateTitleSimilarity)
+	assert.Less(t, titleSimilarity("TI-84 Plus calculator", "Oak desk"), duplicateTitleSimilarity)
+	assert.Equal(t, 0.0, titleSimilarity("", "Oak desk"))
+}
+
+func TestPricesClose(t *testing.T) {
+	assert.True(t, pricesClose(5000, 5000))
+	assert.True(t, pricesClose(5000, 4500))
+	assert.False(t, pricesClose(5000, 4000))
+	assert.True(t, pricesClose(0, 0))
+}
+
+func TestMatchDuplicate(t *testing.T) {
+	candidates := []duplicateCandidate{
+		{ID: 1, UserID: 7, ProductName: "Desk lamp", Price: 1500},
+		{ID: 2, UserID: 8, ProductName: "TI-84 Plus calculator", Price: 6000},
+		{ID: 3, UserID: 7, ProductName: "TI-84 Plus calculator", Price: 6000},
+	}
+
+	// The seller's own listing matches on title and price; the other
+	// seller's identical listing does not.
+	match := matchDuplicate(7, "TI 84 plus calculator", 5800, candidates)
+	assert.Equal(t, &DuplicateMatch{ListingID: 3, SameSeller: true, Reasons: []string{"has a similar title and price"}}, match)
+
+	assert.Nil(t, matchDuplicate(7, "TI-84 Plus calculator", 3000, candidates))
+	assert.Nil(t, matchDuplicate(9, "TI-84 Plus calculator", 6000, candidates))
+
+	// A shared photo matches across sellers and outranks a title match.
+	candidates[1].SameImage = true
+	match = matchDuplicate(7, "TI-84 Plus calculator", 6000, candidates)
+	assert.Equal(t, &DuplicateMatch{ListingID: 2, SameSeller: false, Reasons: []string{"uses the same photo"}}, match)
+}
+
+func TestListingsHandlerDuplicates(t *testing.T) {
+	stubListingRevisions(t)
+	originalResolve := resolveCategory
+	originalAttributes := getCategoryAttributes
+	originalCandidates := findDuplicateCandidates
+	originalMerge := mergeDuplicateListing
+	originalGetListing := getListing
+	defer func() {
+		resolveCategory = originalResolve
+		getCategoryAttributes = originalAttributes
+		findDuplicateCandidates = originalCandidates
+		mergeDuplicateListing = originalMerge
+		getListing = originalGetListing
+	}()
+	resolveCategory = func(input string) (string, error) { return input, nil }
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	findDuplicateCandidates = func(userID int, since time.Time, imageHashes []string) ([]duplicateCandidate, error) {
+		return []duplicateCandidate{
+			{ID: 4, UserID: 1, ProductName: "Oak desk", Price: 4000},
+			{ID: 5, UserID: 2, ProductName: "Mini fridge", Price: 6000, SameImage: true},
+		}, nil
+	}
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+	var merged int
+	mergeDuplicateListing = func(listingID int, images []listingImage) error {
+		merged = listingID
+		return nil
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		fields         map[string]string
+		expectedStatus int
+		wantExisting   int
+		wantMerged     int
+	}{
+		{"Own duplicate rejected", "1", map[string]string{"productName": "oak desk", "price": "40", "category": "furniture"}, http.StatusConflict, 4, 0},
+		{"Own duplicate merged", "1", map[string]string{"productName": "oak desk", "price": "40", "category": "furniture", "onDuplicate": "merge"}, http.StatusOK, 0, 4},
+		{"Cross-post cannot be merged", "3", map[string]string{"productName": "Fridge", "price": "60", "category": "appliances", "onDuplicate": "merge"}, http.StatusConflict, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer mockDB.Close()
+			originalDB := db
+			db = mockDB
+			defer func() { db = originalDB }()
+			if tt.wantMerged != 0 {
+				mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+					WithArgs(tt.wantMerged).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+			}
+			merged = 0
+
+			body, contentType := listingForm(t, tt.fields)
+			req := httptest.NewRequest(http.MethodPost, "/listings", body)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			listingsHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.wantMerged, merged)
+			if tt.wantMerged != 0 {
+				var l Listing
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &l))
+				assert.Equal(t, tt.wantMerged, l.ID)
+				assert.True(t, l.Duplicate.Merged)
+			}
+			if tt.wantExisting != 0 {
+				var resp struct {
+					ExistingListingID int `json:"existingListingId"`
+				}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantExisting, resp.ExistingListingID)
+			}
+			// Duplicates are never inserted.
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMergeDuplicateListing(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	images := []listingImage{
+		{Data: []byte("known"), ContentType: "image/png"},
+		{Data: []byte("new"), ContentType: "image/png"},
+		{Data: []byte("over the limit"), ContentType: "image/png"},
+	}
+	insert := "INSERT INTO listing_images\\(listing_id, image_data, content_type\\)"
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT id FROM listings WHERE id = \\$1 FOR UPDATE").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM listing_images WHERE listing_id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(maxListingImages - 1))
+	// The image the listing already has is skipped, the next one fills the
+	// last slot and the rest are dropped.
+	mock.ExpectExec(insert).
+		WithArgs(7, []byte("known"), "image/png", imageContentHash([]byte("known"))).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).
+		WithArgs(7, []byte("new"), "image/png", imageContentHash([]byte("new"))).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Only updated_at changes; the expiry is not renewed.
+	mock.ExpectExec("UPDATE listings SET updated_at = \\$1 WHERE id = \\$2").
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, mergeDuplicateListing(7, images))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// initFavoritesDB creates the favorites table linking users to the listings
+// they follow. Rows go away with either the user or the listing.
+func initFavoritesDB() error {
+	favoritesTable := `
+	CREATE TABLE IF NOT EXISTS favorites (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, listing_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_favorites_listing ON favorites (listing_id);`
+	if _, err := db.Exec(favoritesTable); err != nil {
+		return fmt.Errorf("error creating favorites table: %v", err)
+	}
+	return nil
+}
+
+// favoriteColumns returns extra select columns, to follow listingColumns,
+// with the listing's favorite count and whether the user bound to the
+// placeholder userParam has favorited it. Scan them into FavoriteCount and
+// IsFavorited.
+func favoriteColumns(userParam string) string {
+	return ", (SELECT COUNT(*) FROM favorites f WHERE f.listing_id = l.id)" +
+		", EXISTS (SELECT 1 FROM favorites f WHERE f.listing_id = l.id AND f.user_id = " + userParam + ")"
+}
+
+// addFavorite favorites a listing for the user. Favoriting twice is a no-op.
+var addFavorite = func(userID, listingID int) error {
+	_, err := db.Exec(
+		"INSERT INTO favorites(user_id, listing_id) VALUES($1, $2) ON CONFLICT DO NOTHING",
+		userID, listingID,
+	)
+	return err
+}
+
+// removeFavorite unfavorites a listing for the user.
+var removeFavorite = func(userID, listingID int) error {
+	_, err := db.Exec("DELETE FROM favorites WHERE user_id = $1 AND listing_id = $2", userID, listingID)
+	return err
+}
+
+// favoriteListingHandler handles POST /listings/{id}/favorite, which adds
+// the listing to the user's favorites, and DELETE, which removes it.
+func favoriteListingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := removeFavorite(currentUserID, listingID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Listing removed from favorites"})
+		return
+	}
+
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if l.Status == StatusDraft {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return
+	}
+	if l.UserID == currentUserID {
+		http.Error(w, "You cannot favorite your own listing", http.StatusBadRequest)
+		return
+	}
+	if err := addFavorite(currentUserID, listingID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Listing added to favorites"})
+}
+
+// favoritesHandler handles GET /favorites and returns a page of the
+// listings the user has favorited, newest first. Sold and archived
+// listings stay on the list so the user can see what happened to them.
+func favoritesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := &listingQuery{}
+	favoritedBy := q.bind(currentUserID)
+	q.where("l.id IN (SELECT listing_id FROM favorites WHERE user_id = $%d)", currentUserID)
+	q.where("l.deleted_at IS NULL")
+	q.where("l.status <> $%d", StatusDraft)
+	if err := q.paginate(defaultListingSort, cursor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, args := q.build("SELECT "+listingColumns+favoriteColumns(favoritedBy)+listingFrom, limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var listings []Listing
+	for rows.Next() {
+		var l Listing
+		if err := scanListing(rows, &l, &l.FavoriteCount, &l.IsFavorited); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		l.Images = fetchListingImages(l.ID)
+		listings = append(listings, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newListingsPage(listings, limit, defaultListingSort))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFavoriteListingHandler(t *testing.T) {
+	originalGetListing := getListing
+	originalAdd := addFavorite
+	originalRemove := removeFavorite
+	defer func() {
+		getListing = originalGetListing
+		addFavorite = originalAdd
+		removeFavorite = originalRemove
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		switch listingID {
+		case 404:
+			return Listing{}, sql.ErrNoRows
+		case 6:
+			return Listing{ID: listingID, UserID: 2, Status: StatusDraft}, nil
+		}
+		return Listing{ID: listingID, UserID: 2, Status: StatusActive}, nil
+	}
+	var added, removed []int
+	addFavorite = func(userID, listingID int) error {
+		added = append(added, listingID)
+		return nil
+	}
+	removeFavorite = func(userID, listingID int) error {
+		removed = append(removed, listingID)
+		return nil
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		listingID      string
+		userID         string
+		expectedStatus int
+	}{
+		{"favorite", http.MethodPost, "5", "1", http.StatusOK},
+		{"own listing", http.MethodPost, "5", "2", http.StatusBadRequest},
+		{"draft", http.MethodPost, "6", "1", http.StatusNotFound},
+		{"missing listing", http.MethodPost, "404", "1", http.StatusNotFound},
+		{"unfavorite", http.MethodDelete, "5", "1", http.StatusOK},
+		{"wrong method", http.MethodGet, "5", "1", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/listings/"+tt.listingID+"/favorite", nil)
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			favoriteListingHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+	assert.Equal(t, []int{5}, added)
+	assert.Equal(t, []int{5}, removed)
+}
+
+func TestFavoritesHandler(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock DB: %v", err)
+	}
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	now := time.Now()
+	columns := []string{"id", "user_id", "name", "email", "phone", "product_name", "product_description", "price",
+		"category", "category_name", "status", "attributes", "created_at", "updated_at", "expires_at", "publish_at",
+		"pickup_location_id", "pickup_slug", "pickup_name", "pickup_lat", "pickup_lon", "tags",
+		"favorite_count", "is_favorited"}
+	mock.ExpectQuery(`SELECT .*, \(SELECT COUNT\(\*\) FROM favorites f WHERE f.listing_id = l.id\), EXISTS \(SELECT 1 FROM favorites f WHERE f.listing_id = l.id AND f.user_id = \$1\) FROM listings l .* WHERE l.id IN \(SELECT listing_id FROM favorites WHERE user_id = \$2\)`).
+		WithArgs(1, 1, StatusDraft).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, 2, "Seller", "s@ufl.edu", "", "Desk", "", 40.0, "furniture", "Furniture", StatusActive, []byte(`{}`), now, now, now, nil, 2, "reitz-union", "Reitz Union", 29.6463, -82.3478, "{dorm,ikea}", 3, true))
+	mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/favorites", nil)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+
+	favoritesHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var page ListingsPage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	assert.Len(t, page.Listings, 1)
+	assert.Equal(t, 3, page.Listings[0].FavoriteCount)
+	assert.True(t, page.Listings[0].IsFavorited)
+	assert.Equal(t, "Reitz Union", page.Listings[0].PickupLocation.Name)
+	assert.Equal(t, []string{"dorm", "ikea"}, page.Listings[0].Tags)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
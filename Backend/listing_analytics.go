@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Listing event kinds. Each is counted at most once per user, listing and day.
+const (
+	EventView    = "view"
+	EventInquiry = "inquiry"
+)
+
+// Event buffering. Events are held in memory and written in batches so that
+// recording them never adds a database round trip to the request.
+const (
+	listingEventsFlushInterval = 10 * time.Second
+	maxBufferedListingEvents   = 10000
+	defaultAnalyticsDays       = 30
+	maxAnalyticsDays           = 365
+)
+
+// initListingAnalyticsDB creates listing_events, which deduplicates events
+// per user per day, and listing_daily_stats, which holds the counters the
+// analytics endpoint reads.
+func initListingAnalyticsDB() error {
+	analyticsSchema := `
+	CREATE TABLE IF NOT EXISTS listing_events (
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL CHECK (kind IN ('view', 'inquiry')),
+		day DATE NOT NULL,
+		PRIMARY KEY (listing_id, user_id, kind, day)
+	);
+	CREATE TABLE IF NOT EXISTS listing_daily_stats (
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		day DATE NOT NULL,
+		views INTEGER NOT NULL DEFAULT 0,
+		inquiries INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (listing_id, day)
+	);`
+	if _, err := db.Exec(analyticsSchema); err != nil {
+		return fmt.Errorf("error creating listing analytics tables: %v", err)
+	}
+	return nil
+}
+
+// listingEvent is one buffered event. Day is formatted as 2006-01-02.
+type listingEvent struct {
+	ListingID int
+	UserID    int
+	Kind      string
+	Day       string
+}
+
+// listingEventBuffer collects events until the next flush. Duplicates
+// within a flush interval are dropped in memory.
+type listingEventBuffer struct {
+	mu      sync.Mutex
+	pending map[listingEvent]struct{}
+	dropped int
+}
+
+// listingEvents is the process-wide event buffer, flushed by the
+// flush-listing-events job.
+var listingEvents = &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+
+// record buffers an event for the current day. It never blocks on the
+// database; once maxBufferedListingEvents are pending, new events are dropped
+// until the next flush.
+func (b *listingEventBuffer) record(listingID, userID int, kind string) {
+	e := listingEvent{ListingID: listingID, UserID: userID, Kind: kind, Day: time.Now().Format("2006-01-02")}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pending[e]; !ok && len(b.pending) >= maxBufferedListingEvents {
+		b.dropped++
+		return
+	}
+	b.pending[e] = struct{}{}
+}
+
+// take empties the buffer and returns what it held.
+func (b *listingEventBuffer) take() ([]listingEvent, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make([]listingEvent, 0, len(b.pending))
+	for e := range b.pending {
+		events = append(events, e)
+	}
+	dropped := b.dropped
+	b.pending = map[listingEvent]struct{}{}
+	b.dropped = 0
+	return events, dropped
+}
+
+// flushListingEventsSQL inserts a batch of events, skipping ones already
+// recorded and ones whose listing has since been purged, and adds the new
+// ones to the daily counters.
+const flushListingEventsSQL = `
+WITH batch AS (
+	SELECT * FROM unnest($1::int[], $2::int[], $3::text[], $4::date[]) AS b(listing_id, user_id, kind, day)
+	WHERE EXISTS (SELECT 1 FROM listings l WHERE l.id = b.listing_id)
+), inserted AS (
+	INSERT INTO listing_events(listing_id, user_id, kind, day)
+	SELECT listing_id, user_id, kind, day FROM batch
+	ON CONFLICT DO NOTHING
+	RETURNING listing_id, kind, day
+)
+INSERT INTO listing_daily_stats(listing_id, day, views, inquiries)
+SELECT listing_id, day, COUNT(*) FILTER (WHERE kind = 'view'), COUNT(*) FILTER (WHERE kind = 'inquiry')
+FROM inserted GROUP BY listing_id, day
+ON CONFLICT (listing_id, day) DO UPDATE SET
+	views = listing_daily_stats.views + EXCLUDED.views,
+	inquiries = listing_daily_stats.inquiries + EXCLUDED.inquiries`
+
+// writeListingEvents stores a batch of events.
+var writeListingEvents = func(events []listingEvent) error {
+	listingIDs := make([]int64, len(events))
+	userIDs := make([]int64, len(events))
+	kinds := make([]string, len(events))
+	days := make([]string, len(events))
+	for i, e := range events {
+		listingIDs[i] = int64(e.ListingID)
+		userIDs[i] = int64(e.UserID)
+		kinds[i] = e.Kind
+		days[i] = e.Day
+	}
+	_, err := db.Exec(flushListingEventsSQL, pq.Array(listingIDs), pq.Array(userIDs), pq.Array(kinds), pq.Array(days))
+	return err
+}
+
+// flush writes the buffered events. A failed batch is logged and dropped
+// rather than retried, so a database outage cannot grow the buffer.
+func (b *listingEventBuffer) flush() error {
+	events, dropped := b.take()
+	if dropped > 0 {
+		log.Printf("Dropped %d listing events because the buffer was full", dropped)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if err := writeListingEvents(events); err != nil {
+		return fmt.Errorf("writing %d listing events: %v", len(events), err)
+	}
+	return nil
+}
+
+// listingEventsJob returns the background job that flushes buffered events.
+// It flushes once more on shutdown so that pending events are not lost.
+func listingEventsJob() scheduledJob {
+	return scheduledJob{Name: "flush-listing-events", Interval: listingEventsFlushInterval, Run: listingEvents.flush, RunOnStop: true}
+}
+
+// listingInquiryHandler handles POST /listings/{id}/inquiry, which the
+// frontend calls when a buyer contacts the seller, and counts it towards
+// the listing's inquiries.
+func listingInquiryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if l.Status == StatusDraft {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return
+	}
+	if l.UserID != currentUserID {
+		listingEvents.record(listingID, currentUserID, EventInquiry)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ListingDayStats holds one listing's activity on one day.
+type ListingDayStats struct {
+	Date      string `json:"date"`
+	Views     int    `json:"views"`
+	Favorites int    `json:"favorites"`
+	Inquiries int    `json:"inquiries"`
+}
+
+// ListingAnalytics summarizes activity on one of the seller's listings.
+// Totals cover the listing's whole life; Daily only lists days with activity
+// inside the requested window. Favorites counts current favorites by the
+// day they were added.
+type ListingAnalytics struct {
+	ListingID   int               `json:"listingId"`
+	ProductName string            `json:"productName"`
+	Status      string            `json:"status"`
+	Views       int               `json:"views"`
+	Favorites   int               `json:"favorites"`
+	Inquiries   int               `json:"inquiries"`
+	Daily       []ListingDayStats `json:"daily"`
+}
+
+// getSellerAnalytics returns analytics for every listing of the user, with
+// daily figures from since onwards.
+var getSellerAnalytics = func(userID int, since time.Time) ([]ListingAnalytics, error) {
+	rows, err := db.Query(
+		`SELECT l.id, l.product_name, l.status,
+			COALESCE((SELECT SUM(s.views) FROM listing_daily_stats s WHERE s.listing_id = l.id), 0),
+			(SELECT COUNT(*) FROM favorites f WHERE f.listing_id = l.id),
+			COALESCE((SELECT SUM(s.inquiries) FROM listing_daily_stats s WHERE s.listing_id = l.id), 0)
+		FROM listings l
+		WHERE l.user_id = $1 AND l.deleted_at IS NULL
+		ORDER BY l.created_at DESC, l.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	analytics := []ListingAnalytics{}
+	byID := map[int]*ListingAnalytics{}
+	for rows.Next() {
+		var a ListingAnalytics
+		if err := rows.Scan(&a.ListingID, &a.ProductName, &a.Status, &a.Views, &a.Favorites, &a.Inquiries); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.Daily = []ListingDayStats{}
+		analytics = append(analytics, a)
+	}
+	rows.Close()
+	for i := range analytics {
+		byID[analytics[i].ListingID] = &analytics[i]
+	}
+
+	rows, err = db.Query(
+		`SELECT listing_id, to_char(day, 'YYYY-MM-DD'), SUM(views), SUM(favorites), SUM(inquiries) FROM (
+			SELECT s.listing_id, s.day, s.views, 0 AS favorites, s.inquiries
+			FROM listing_daily_stats s JOIN listings l ON l.id = s.listing_id
+			WHERE l.user_id = $1 AND s.day >= $2::date
+			UNION ALL
+			SELECT f.listing_id, f.created_at::date, 0, 1, 0
+			FROM favorites f JOIN listings l ON l.id = f.listing_id
+			WHERE l.user_id = $1 AND f.created_at >= $2::date
+		) activity
+		GROUP BY listing_id, day`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var listingID int
+		var d ListingDayStats
+		if err := rows.Scan(&listingID, &d.Date, &d.Views, &d.Favorites, &d.Inquiries); err != nil {
+			return nil, err
+		}
+		if a, ok := byID[listingID]; ok {
+			a.Daily = append(a.Daily, d)
+		}
+	}
+	for i := range analytics {
+		daily := analytics[i].Daily
+		sort.Slice(daily, func(x, y int) bool { return daily[x].Date < daily[y].Date })
+	}
+	return analytics, rows.Err()
+}
+
+// sellerAnalyticsHandler handles GET /listings/user/analytics?days=30 and
+// returns views, favorites and inquiries for each of the user's listings.
+func sellerAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+	days := defaultAnalyticsDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil || days < 1 || days > maxAnalyticsDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxAnalyticsDays), http.StatusBadRequest)
+			return
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -(days - 1))
+	analytics, err := getSellerAnalytics(userID, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":     days,
+		"listings": analytics,
+	})
+}
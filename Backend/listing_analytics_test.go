@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingEventBufferDeduplicates(t *testing.T) {
+	b := &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+	b.record(1, 2, EventView)
+	b.record(1, 2, EventView)
+	b.record(1, 3, EventView)
+	b.record(1, 2, EventInquiry)
+
+	events, dropped := b.take()
+	assert.Len(t, events, 3)
+	assert.Zero(t, dropped)
+
+	events, _ = b.take()
+	assert.Empty(t, events)
+}
+
+func TestListingEventBufferDropsWhenFull(t *testing.T) {
+	b := &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+	for i := 0; i < maxBufferedListingEvents+5; i++ {
+		b.record(1, i, EventView)
+	}
+	events, dropped := b.take()
+	assert.Len(t, events, maxBufferedListingEvents)
+	assert.Equal(t, 5, dropped)
+}
+
+func TestListingEventBufferFlush(t *testing.T) {
+	originalWrite := writeListingEvents
+	defer func() { writeListingEvents = originalWrite }()
+
+	var written []listingEvent
+	writeListingEvents = func(events []listingEvent) error {
+		written = append(written, events...)
+		return nil
+	}
+	b := &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+	assert.NoError(t, b.flush())
+	assert.Empty(t, written)
+
+	b.record(4, 2, EventView)
+	assert.NoError(t, b.flush())
+	assert.Equal(t, []listingEvent{{ListingID: 4, UserID: 2, Kind: EventView, Day: time.Now().Format("2006-01-02")}}, written)
+
+	writeListingEvents = func(events []listingEvent) error { return errors.New("db down") }
+	b.record(4, 3, EventView)
+	assert.Error(t, b.flush())
+	events, _ := b.take()
+	assert.Empty(t, events)
+}
+
+func TestListingDetailRecordsView(t *testing.T) {
+	originalGetListing := getListing
+	originalHistory := getPriceHistory
+	originalEvents := listingEvents
+	defer func() {
+		getListing = originalGetListing
+		getPriceHistory = originalHistory
+		listingEvents = originalEvents
+	}()
+	listingEvents = &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 2, Status: StatusActive}, nil
+	}
+	getPriceHistory = func(listingID int) ([]PriceChange, error) { return nil, nil }
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock DB: %v", err)
+	}
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+	}
+
+	for _, userID := range []string{"1", "2"} {
+		req := httptest.NewRequest(http.MethodGet, "/listings/5", nil)
+		req.SetPathValue("id", "5")
+		req.Header.Set("userId", userID)
+		listingDetailHandler(httptest.NewRecorder(), req)
+	}
+
+	events, _ := listingEvents.take()
+	// The seller's own view is not counted.
+	assert.Len(t, events, 1)
+	assert.Equal(t, 1, events[0].UserID)
+}
+
+func TestSellerAnalyticsHandler(t *testing.T) {
+	originalGet := getSellerAnalytics
+	defer func() { getSellerAnalytics = originalGet }()
+
+	var gotSince time.Time
+	getSellerAnalytics = func(userID int, since time.Time) ([]ListingAnalytics, error) {
+		gotSince = since
+		return []ListingAnalytics{{ListingID: 5, Views: 3, Daily: []ListingDayStats{{Date: "2025-03-01", Views: 3}}}}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/listings/user/analytics?days=7", nil)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+	sellerAnalyticsHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var body struct {
+		Days     int                `json:"days"`
+		Listings []ListingAnalytics `json:"listings"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, 7, body.Days)
+	assert.Equal(t, 3, body.Listings[0].Views)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -6), gotSince, time.Minute)
+
+	req = httptest.NewRequest(http.MethodGet, "/listings/user/analytics?days=0", nil)
+	req.Header.Set("userId", "1")
+	rr = httptest.NewRecorder()
+	sellerAnalyticsHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestListingInquiryHandler(t *testing.T) {
+	originalGetListing := getListing
+	originalEvents := listingEvents
+	defer func() {
+		getListing = originalGetListing
+		listingEvents = originalEvents
+	}()
+	listingEvents = &listingEventBuffer{pending: map[listingEvent]struct{}{}}
+
+	tests := []struct {
+		name       string
+		listing    Listing
+		err        error
+		wantStatus int
+		wantEvents int
+	}{
+		{"Recorded", Listing{ID: 5, UserID: 2, Status: StatusActive}, nil, http.StatusAccepted, 1},
+		{"Own listing", Listing{ID: 5, UserID: 1, Status: StatusActive}, nil, http.StatusAccepted, 0},
+		{"Draft", Listing{ID: 5, UserID: 2, Status: StatusDraft}, nil, http.StatusNotFound, 0},
+		{"Missing", Listing{}, sql.ErrNoRows, http.StatusNotFound, 0},
+		{"Database error", Listing{}, errors.New("db down"), http.StatusInternalServerError, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getListing = func(listingID int) (Listing, error) { return tt.listing, tt.err }
+
+			req := httptest.NewRequest(http.MethodPost, "/listings/5/inquiry", nil)
+			req.SetPathValue("id", "5")
+			req.Header.Set("userId", "1")
+			rr := httptest.NewRecorder()
+			listingInquiryHandler(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			events, _ := listingEvents.take()
+			assert.Len(t, events, tt.wantEvents)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultListingRestoreDays is used when config.json leaves
+// listings.restoreDays unset.
+const defaultListingRestoreDays = 30
+
+// listingRestoreWindow is how long a deleted listing can be restored before
+// the purge job removes it for good.
+func listingRestoreWindow() time.Duration {
+	days := appConfig.Listings.RestoreDays
+	if days <= 0 {
+		days = defaultListingRestoreDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// initListingDeletionDB adds the deleted_at column used for soft deletes.
+func initListingDeletionDB() error {
+	deletionSchema := `
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	CREATE INDEX IF NOT EXISTS idx_listings_deleted_at ON listings (deleted_at) WHERE deleted_at IS NOT NULL;`
+	if _, err := db.Exec(deletionSchema); err != nil {
+		return fmt.Errorf("error adding listings deleted_at column: %v", err)
+	}
+	return nil
+}
+
+// softDeleteListing marks a listing as deleted. It reports false when the
+// listing does not belong to the user or is already deleted.
+var softDeleteListing = func(listingID, userID int) (bool, error) {
+	now := time.Now()
+	res, err := db.Exec(
+		"UPDATE listings SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL",
+		now, listingID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// restoreListing clears deleted_at on a listing the user deleted within the
+// restore window. It reports false when there is nothing to restore.
+var restoreListing = func(listingID, userID int) (bool, error) {
+	now := time.Now()
+	res, err := db.Exec(
+		`UPDATE listings SET deleted_at = NULL, updated_at = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NOT NULL AND deleted_at > $4`,
+		now, listingID, userID, now.Add(-listingRestoreWindow()),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// listingPurgeJob returns the background job that hard-deletes listings
+// whose restore window has passed.
+func listingPurgeJob() scheduledJob {
+	return scheduledJob{Name: "purge-deleted-listings", Interval: listingSweepInterval(), Run: purgeDeletedListings}
+}
+
+// purgeDeletedListings removes listings, and their images, that were
+// deleted longer ago than the restore window.
+func purgeDeletedListings() error {
+	cutoff := time.Now().Add(-listingRestoreWindow())
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"DELETE FROM listing_images WHERE listing_id IN (SELECT id FROM listings WHERE deleted_at <= $1)", cutoff,
+	); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM listings WHERE deleted_at <= $1", cutoff)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Purged %d deleted listings", n)
+	}
+	return nil
+}
+
+// restoreListingHandler handles POST /listings/{id}/restore and brings back
+// a listing its owner deleted within the restore window.
+func restoreListingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	recordRestore := trackListingChange(listingID, currentUserID, RevisionRestore)
+	restored, err := restoreListing(listingID, currentUserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !restored {
+		http.Error(w, "No deleted listing to restore", http.StatusNotFound)
+		return
+	}
+	recordRestore()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Listing restored successfully"})
+}
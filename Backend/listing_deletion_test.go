@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingRestoreWindow(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+
+	appConfig.Listings.RestoreDays = 0
+	assert.Equal(t, defaultListingRestoreDays*24*time.Hour, listingRestoreWindow())
+	appConfig.Listings.RestoreDays = 7
+	assert.Equal(t, 7*24*time.Hour, listingRestoreWindow())
+}
+
+func TestDeleteListingHandlerSoftDeletes(t *testing.T) {
+	stubListingRevisions(t)
+	originalGetListing := getListing
+	originalSoftDelete := softDeleteListing
+	defer func() {
+		getListing = originalGetListing
+		softDeleteListing = originalSoftDelete
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+	var deletedID int
+	softDeleteListing = func(listingID, userID int) (bool, error) {
+		deletedID = listingID
+		return true, nil
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/listing/deleteListing?listingId=5", nil)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+
+	deleteListingHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 5, deletedID)
+}
+
+func TestRestoreListingHandler(t *testing.T) {
+	stubListingRevisions(t)
+	originalRestore := restoreListing
+	defer func() { restoreListing = originalRestore }()
+
+	restoreListing = func(listingID, userID int) (bool, error) {
+		// Only listing 5, owned by user 1, is restorable.
+		return listingID == 5 && userID == 1, nil
+	}
+
+	tests := []struct {
+		name           string
+		listingID      string
+		userID         string
+		expectedStatus int
+	}{
+		{"restores own listing", "5", "1", http.StatusOK},
+		{"other user's listing", "5", "2", http.StatusNotFound},
+		{"nothing to restore", "6", "1", http.StatusNotFound},
+		{"invalid id", "abc", "1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/listings/"+tt.listingID+"/restore", nil)
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			restoreListingHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// getListing loads a single listing with its seller info, without images.
+// It returns sql.ErrNoRows when no listing has the given id.
+var getListing = func(listingID int) (Listing, error) {
+	var l Listing
+	err := scanListing(db.QueryRow("SELECT "+listingColumns+listingFrom+" WHERE l.id = $1 AND l.deleted_at IS NULL", listingID), &l)
+	return l, err
+}
+
+// requireListingOwner looks up a listing and checks that it belongs to userID.
+// On failure it writes a 404, 401 or 500 response and returns false.
+func requireListingOwner(w http.ResponseWriter, listingID, userID int) (Listing, bool) {
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return l, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return l, false
+	}
+	if l.UserID != userID {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return l, false
+	}
+	return l, true
+}
+
+// listingDetailHandler handles GET /listings/{id} and returns one listing
+// with seller info, images, price history and timestamps. Drafts are only
+// visible to their owner.
+func listingDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+
+	currentUserID, _ := strconv.Atoi(r.Header.Get("userId"))
+
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if l.Status == StatusDraft && l.UserID != currentUserID {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return
+	}
+	if currentUserID != 0 && currentUserID != l.UserID {
+		listingEvents.record(l.ID, currentUserID, EventView)
+	}
+	l.Images = fetchListingImages(l.ID)
+	if l.PriceHistory, err = getPriceHistory(l.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingDetailHandler(t *testing.T) {
+	originalGetListing := getListing
+	defer func() { getListing = originalGetListing }()
+
+	t.Run("Found", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock DB: %v", err)
+		}
+		defer mockDB.Close()
+		originalDB := db
+		db = mockDB
+		defer func() { db = originalDB }()
+
+		getListing = func(listingID int) (Listing, error) {
+			return Listing{ID: listingID, UserID: 2, ProductName: "Desk"}, nil
+		}
+		mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}).AddRow(1, []byte("img"), "image/png"))
+		mock.ExpectQuery("SELECT old_price, new_price, changed_at FROM listing_price_history WHERE listing_id = \\$1").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"old_price", "new_price", "changed_at"}).AddRow(120.0, 100.0, time.Now()))
+
+		req := httptest.NewRequest(http.MethodGet, "/listings/5", nil)
+		req.SetPathValue("id", "5")
+		w := httptest.NewRecorder()
+		listingDetailHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var l Listing
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &l))
+		assert.Equal(t, 5, l.ID)
+		assert.Equal(t, "Desk", l.ProductName)
+		assert.Len(t, l.Images, 1)
+		assert.Equal(t, []PriceChange{{OldPrice: 12000, NewPrice: 10000, ChangedAt: l.PriceHistory[0].ChangedAt}}, l.PriceHistory)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		getListing = func(listingID int) (Listing, error) {
+			return Listing{}, sql.ErrNoRows
+		}
+		req := httptest.NewRequest(http.MethodGet, "/listings/99", nil)
+		req.SetPathValue("id", "99")
+		w := httptest.NewRecorder()
+		listingDetailHandler(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Invalid id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/listings/abc", nil)
+		req.SetPathValue("id", "abc")
+		w := httptest.NewRecorder()
+		listingDetailHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRequireListingOwner(t *testing.T) {
+	originalGetListing := getListing
+	defer func() { getListing = originalGetListing }()
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 2}, nil
+	}
+
+	w := httptest.NewRecorder()
+	_, ok := requireListingOwner(w, 5, 2)
+	assert.True(t, ok)
+
+	w = httptest.NewRecorder()
+	_, ok = requireListingOwner(w, 5, 3)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
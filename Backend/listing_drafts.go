@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publishDraftsInterval is how often scheduled drafts are checked.
+const publishDraftsInterval = time.Minute
+
+// initListingDraftsDB adds the publish_at column used for scheduled drafts,
+// and lets drafts be saved without a price.
+func initListingDraftsDB() error {
+	draftsSchema := `
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+	ALTER TABLE listings ALTER COLUMN price DROP NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_listings_draft_publish_at ON listings (publish_at) WHERE status = 'draft';`
+	if _, err := db.Exec(draftsSchema); err != nil {
+		return fmt.Errorf("error adding listings publish_at column: %v", err)
+	}
+	return nil
+}
+
+// parsePublishAt parses an optional RFC 3339 publish time, which must be in the future.
+func parsePublishAt(raw string) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("publishAt must be an RFC 3339 timestamp")
+	}
+	if !t.After(time.Now()) {
+		return nil, fmt.Errorf("publishAt must be in the future")
+	}
+	return &t, nil
+}
+
+// validateListingForPublish checks that a draft has everything a public
+// listing needs. Drafts may be saved without a name, category or price.
+func validateListingForPublish(l Listing) error {
+	if strings.TrimSpace(l.ProductName) == "" {
+		return fmt.Errorf("productName is required to publish")
+	}
+	if l.Category == "" {
+		return fmt.Errorf("category is required to publish")
+	}
+	if !l.PriceSet {
+		return fmt.Errorf("price is required to publish")
+	}
+	return nil
+}
+
+// listingPublished runs the side effects of a listing becoming public,
+// whether it was created active, published by its seller or published on
+// schedule. The listing is matched against saved searches, and if it now
+// duplicates another public listing it is queued for moderators. Errors are
+// logged, since the listing is already public.
+var listingPublished = func(listingID int) {
+	matchSavedSearches(listingID)
+
+	l, err := getListing(listingID)
+	if err != nil {
+		log.Printf("Error loading listing %d for the duplicate check: %v", listingID, err)
+		return
+	}
+	duplicate, err := findDuplicateOfListing(l)
+	if err != nil {
+		log.Printf("Error checking listing %d for duplicates: %v", listingID, err)
+		return
+	}
+	if duplicate != nil {
+		flagListingForReview(listingID, []string{
+			fmt.Sprintf("Possible duplicate of listing %d: it %s", duplicate.ListingID, strings.Join(duplicate.Reasons, " and ")),
+		})
+	}
+}
+
+// publishListing makes a draft active now. The feed is ordered by
+// created_at, so publishing stamps created_at and starts the expiry clock
+// so the listing shows up as new.
+var publishListing = func(listingID int) error {
+	now := time.Now()
+	res, err := db.Exec(
+		`UPDATE listings SET status = $1, publish_at = NULL, created_at = $2, updated_at = $2, expires_at = $3
+		WHERE id = $4 AND status = $5`,
+		StatusActive, now, now.Add(listingExpiryDuration()), listingID, StatusDraft,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scheduleListing sets the time at which the scheduled drafts job publishes a draft.
+var scheduleListing = func(listingID int, publishAt time.Time) error {
+	res, err := db.Exec(
+		"UPDATE listings SET publish_at = $1, updated_at = $2 WHERE id = $3 AND status = $4",
+		publishAt, time.Now(), listingID, StatusDraft,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// publishScheduledDrafts activates drafts whose publish_at has passed,
+// records a system revision for each and runs listingPublished on them.
+func publishScheduledDrafts() error {
+	now := time.Now()
+	rows, err := db.Query(bulkStatusChangeSQL(
+		`UPDATE listings SET status = $1, publish_at = NULL, created_at = $2, updated_at = $2, expires_at = $3
+		WHERE status = $4 AND publish_at <= $2 AND deleted_at IS NULL`, 4)+" RETURNING listing_id",
+		StatusActive, now, now.Add(listingExpiryDuration()), StatusDraft,
+	)
+	if err != nil {
+		return err
+	}
+	var published []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		published = append(published, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(published) > 0 {
+		log.Printf("Published %d scheduled listings", len(published))
+	}
+	for _, id := range published {
+		listingPublished(id)
+	}
+	return nil
+}
+
+type publishListingRequest struct {
+	PublishAt string `json:"publishAt"`
+}
+
+// publishListingHandler handles POST /listings/{id}/publish. With an empty
+// body the draft goes live immediately; with a publishAt time it is
+// scheduled and published later by publishScheduledDrafts.
+func publishListingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	var req publishListingRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+	publishAt, err := parsePublishAt(req.PublishAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l, ok := requireListingOwner(w, listingID, currentUserID)
+	if !ok {
+		return
+	}
+	if l.Status != StatusDraft {
+		http.Error(w, "Only drafts can be published", http.StatusConflict)
+		return
+	}
+	if err := validateListingForPublish(l); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Drafts skip the duplicate check when they are saved, so it runs here.
+	duplicate, err := findDuplicateOfListing(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if duplicate != nil {
+		writeDuplicateConflict(w, duplicate)
+		return
+	}
+
+	message := "Listing published successfully"
+	if publishAt != nil {
+		recordChange := trackListingChange(listingID, currentUserID, RevisionEdit)
+		err = scheduleListing(listingID, *publishAt)
+		message = "Listing scheduled successfully"
+		if err == nil {
+			recordChange()
+		}
+	} else {
+		recordChange := trackListingChange(listingID, currentUserID, RevisionStatus)
+		err = publishListing(listingID)
+		if err == nil {
+			recordChange()
+			go listingPublished(listingID)
+		}
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing is no longer a draft", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   message,
+		"publishAt": publishAt,
+	})
+}
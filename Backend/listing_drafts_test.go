@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePublishAt(t *testing.T) {
+	publishAt, err := parsePublishAt("")
+	assert.NoError(t, err)
+	assert.Nil(t, publishAt)
+
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	publishAt, err = parsePublishAt(future.Format(time.RFC3339))
+	assert.NoError(t, err)
+	assert.True(t, future.Equal(*publishAt))
+
+	_, err = parsePublishAt(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	assert.Error(t, err)
+
+	_, err = parsePublishAt("tomorrow")
+	assert.Error(t, err)
+}
+
+func TestValidateListingForPublish(t *testing.T) {
+	assert.NoError(t, validateListingForPublish(Listing{ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true}))
+	assert.Error(t, validateListingForPublish(Listing{ProductName: " ", Category: "home-kitchen", Price: 1500, PriceSet: true}))
+	assert.Error(t, validateListingForPublish(Listing{ProductName: "Lamp", Price: 1500, PriceSet: true}))
+	assert.Error(t, validateListingForPublish(Listing{ProductName: "Lamp", Category: "home-kitchen"}))
+	// Free listings have a price of zero.
+	assert.NoError(t, validateListingForPublish(Listing{ProductName: "Lamp", Category: "home-kitchen", PriceSet: true}))
+}
+
+// stubDuplicateLookups makes the duplicate check see the given candidates
+// and no stored images, and stops listingPublished from running.
+func stubDuplicateLookups(t *testing.T, candidates []duplicateCandidate) {
+	originalHashes := getListingImageHashes
+	originalCandidates := findDuplicateCandidates
+	originalPublished := listingPublished
+	t.Cleanup(func() {
+		getListingImageHashes = originalHashes
+		findDuplicateCandidates = originalCandidates
+		listingPublished = originalPublished
+	})
+	getListingImageHashes = func(listingID int) ([]string, error) { return nil, nil }
+	findDuplicateCandidates = func(userID int, since time.Time, imageHashes []string) ([]duplicateCandidate, error) {
+		return candidates, nil
+	}
+	listingPublished = func(listingID int) {}
+}
+
+func TestPublishListingHandler(t *testing.T) {
+	stubListingRevisions(t)
+	stubDuplicateLookups(t, []duplicateCandidate{{ID: 9, UserID: 1, ProductName: "Desk lamp", Price: 1500}})
+	originalGetListing := getListing
+	originalPublish := publishListing
+	originalSchedule := scheduleListing
+	defer func() {
+		getListing = originalGetListing
+		publishListing = originalPublish
+		scheduleListing = originalSchedule
+	}()
+
+	var published, scheduled bool
+	publishListing = func(listingID int) error {
+		published = true
+		return nil
+	}
+	scheduleListing = func(listingID int, publishAt time.Time) error {
+		scheduled = true
+		return nil
+	}
+
+	tests := []struct {
+		name            string
+		listing         Listing
+		body            string
+		expectedStatus  int
+		expectPublished bool
+		expectScheduled bool
+	}{
+		{"Publish now", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true}, "", http.StatusOK, true, false},
+		{"Schedule", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true},
+			`{"publishAt":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`, http.StatusOK, false, true},
+		{"Incomplete draft", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Price: 1500, PriceSet: true}, "", http.StatusBadRequest, false, false},
+		{"No price", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "home-kitchen"}, "", http.StatusBadRequest, false, false},
+		{"Free", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "home-kitchen", PriceSet: true}, "", http.StatusOK, true, false},
+		{"Duplicate", Listing{UserID: 1, Status: StatusDraft, ProductName: "desk lamp", Category: "home-kitchen", Price: 1500, PriceSet: true}, "", http.StatusConflict, false, false},
+		{"Already active", Listing{UserID: 1, Status: StatusActive, ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true}, "", http.StatusConflict, false, false},
+		{"Past publishAt", Listing{UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true},
+			`{"publishAt":"2020-01-01T00:00:00Z"}`, http.StatusBadRequest, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			published, scheduled = false, false
+			getListing = func(listingID int) (Listing, error) {
+				l := tt.listing
+				l.ID = listingID
+				return l, nil
+			}
+			req := httptest.NewRequest(http.MethodPost, "/listings/5/publish", strings.NewReader(tt.body))
+			req.SetPathValue("id", "5")
+			req.Header.Set("userId", "1")
+			w := httptest.NewRecorder()
+
+			publishListingHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			assert.Equal(t, tt.expectPublished, published)
+			assert.Equal(t, tt.expectScheduled, scheduled)
+		})
+	}
+}
+
+func TestListingDetailHidesOthersDrafts(t *testing.T) {
+	originalGetListing := getListing
+	defer func() { getListing = originalGetListing }()
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusDraft}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/listings/5", nil)
+	req.SetPathValue("id", "5")
+	req.Header.Set("userId", "2")
+	w := httptest.NewRecorder()
+	listingDetailHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPublishListingConflictWhenNoLongerDraft(t *testing.T) {
+	stubListingRevisions(t)
+	stubDuplicateLookups(t, nil)
+	originalGetListing := getListing
+	originalPublish := publishListing
+	defer func() {
+		getListing = originalGetListing
+		publishListing = originalPublish
+	}()
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusDraft, ProductName: "Lamp", Category: "other", Price: 1500, PriceSet: true}, nil
+	}
+	publishListing = func(listingID int) error { return sql.ErrNoRows }
+
+	req := httptest.NewRequest(http.MethodPost, "/listings/5/publish", nil)
+	req.SetPathValue("id", "5")
+	req.Header.Set("userId", "1")
+	w := httptest.NewRecorder()
+	publishListingHandler(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestPublishScheduledDrafts(t *testing.T) {
+	stubDuplicateLookups(t, nil)
+	var published []int
+	listingPublished = func(listingID int) { published = append(published, listingID) }
+
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	mock.ExpectQuery("WITH changed AS \\(UPDATE listings SET status = \\$1, publish_at = NULL.* RETURNING listing_id").
+		WithArgs(StatusActive, sqlmock.AnyArg(), sqlmock.AnyArg(), StatusDraft).
+		WillReturnRows(sqlmock.NewRows([]string{"listing_id"}).AddRow(4).AddRow(6))
+
+	assert.NoError(t, publishScheduledDrafts())
+	assert.Equal(t, []int{4, 6}, published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListingPublished(t *testing.T) {
+	originalPublished := listingPublished
+	stubDuplicateLookups(t, []duplicateCandidate{
+		{ID: 5, UserID: 1, ProductName: "Lamp", Price: 1500},
+		{ID: 8, UserID: 2, ProductName: "Reading lamp", Price: 1200, SameImage: true},
+	})
+	listingPublished = originalPublished
+	originalMatch := matchSavedSearches
+	originalGetListing := getListing
+	originalFlag := flagListingForReview
+	defer func() {
+		matchSavedSearches = originalMatch
+		getListing = originalGetListing
+		flagListingForReview = originalFlag
+	}()
+	var matched int
+	matchSavedSearches = func(listingID int) { matched = listingID }
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive, ProductName: "Lamp", Category: "home-kitchen", Price: 1500, PriceSet: true}, nil
+	}
+	flagged := map[int][]string{}
+	flagListingForReview = func(listingID int, reasons []string) { flagged[listingID] = reasons }
+
+	listingPublished(5)
+
+	// The listing is not its own duplicate; the cross-post is queued.
+	assert.Equal(t, 5, matched)
+	assert.Equal(t, map[int][]string{5: {"Possible duplicate of listing 8: it uses the same photo"}}, flagged)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"UFMarketPlace/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults used when the listings section of config.json leaves a value unset.
+const (
+	defaultListingExpiryDays    = 30
+	defaultListingReminderDays  = 3
+	defaultSweepIntervalMinutes = 60
+)
+
+// listingExpiryDuration is how long a listing stays up after it is created or renewed.
+func listingExpiryDuration() time.Duration {
+	days := appConfig.Listings.ExpiryDays
+	if days <= 0 {
+		days = defaultListingExpiryDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// listingReminderWindow is how long before expiry the seller is emailed.
+func listingReminderWindow() time.Duration {
+	days := appConfig.Listings.ReminderDays
+	if days <= 0 {
+		days = defaultListingReminderDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// listingSweepInterval is how often the expiry sweeper runs.
+func listingSweepInterval() time.Duration {
+	minutes := appConfig.Listings.SweepIntervalMinutes
+	if minutes <= 0 {
+		minutes = defaultSweepIntervalMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// initListingExpiryDB adds the expiry columns and gives existing listings an
+// expiry based on their creation time. Listings that would already be expired
+// or inside the reminder window get the full reminder window instead, so
+// sellers are emailed before anything is archived.
+func initListingExpiryDB() error {
+	expirySchema := `
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS expiry_reminder_sent_at TIMESTAMPTZ;
+	CREATE INDEX IF NOT EXISTS idx_listings_status_expires_at ON listings (status, expires_at);`
+	if _, err := db.Exec(expirySchema); err != nil {
+		return fmt.Errorf("error adding listings expiry columns: %v", err)
+	}
+
+	_, err := db.Exec(
+		`UPDATE listings SET expires_at = GREATEST(
+			COALESCE(created_at, CURRENT_TIMESTAMP) + $1 * INTERVAL '1 second',
+			CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		) WHERE expires_at IS NULL`,
+		int64(listingExpiryDuration().Seconds()), int64(listingReminderWindow().Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("error backfilling listings expiry: %v", err)
+	}
+	return nil
+}
+
+// listingExpiryJobs returns the background jobs that remind sellers about
+// expiring listings and archive the ones that have expired.
+func listingExpiryJobs() []scheduledJob {
+	return []scheduledJob{
+		{Name: "listing-expiry-reminders", Interval: listingSweepInterval(), Run: sendListingExpiryReminders},
+		{Name: "listing-expiry-archive", Interval: listingSweepInterval(), Run: archiveExpiredListings},
+	}
+}
+
+// archiveExpiredListings archives active listings whose expiry has passed
+// and records a system revision for each.
+func archiveExpiredListings() error {
+	res, err := db.Exec(bulkStatusChangeSQL(
+		"UPDATE listings SET status = $1, updated_at = $2 WHERE status = $3 AND expires_at <= $2 AND deleted_at IS NULL", 3),
+		StatusArchived, time.Now(), StatusActive,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		log.Printf("Archived %d expired listings", n)
+	}
+	return nil
+}
+
+// sendListingExpiryReminders emails sellers whose active listings expire
+// within the reminder window. Each listing is reminded at most once per expiry.
+func sendListingExpiryReminders() error {
+	now := time.Now()
+	rows, err := db.Query(
+		`SELECT l.id, l.product_name, l.expires_at, u.email
+		FROM listings l JOIN users u ON u.id = l.user_id
+		WHERE l.status = $1 AND l.expiry_reminder_sent_at IS NULL AND l.deleted_at IS NULL
+			AND l.expires_at > $2 AND l.expires_at <= $3`,
+		StatusActive, now, now.Add(listingReminderWindow()),
+	)
+	if err != nil {
+		return err
+	}
+
+	type reminder struct {
+		listingID   int
+		productName string
+		expiresAt   time.Time
+		email       string
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var r reminder
+		if err := rows.Scan(&r.listingID, &r.productName, &r.expiresAt, &r.email); err != nil {
+			rows.Close()
+			return err
+		}
+		reminders = append(reminders, r)
+	}
+	rows.Close()
+
+	for _, r := range reminders {
+		if err := utils.SendListingExpiryReminder(r.email, r.productName, r.expiresAt); err != nil {
+			log.Printf("Error sending expiry reminder for listing %d: %v", r.listingID, err)
+			continue
+		}
+		if _, err := db.Exec("UPDATE listings SET expiry_reminder_sent_at = $1 WHERE id = $2", time.Now(), r.listingID); err != nil {
+			log.Printf("Error marking expiry reminder for listing %d: %v", r.listingID, err)
+		}
+	}
+	return nil
+}
+
+// renewListing pushes a listing's expiry out by a full period from now and
+// clears its reminder. An archived listing whose expiry has passed was
+// archived by the sweeper, so renewing it makes it active again; this is the
+// one way out of the archived status.
+var renewListing = func(listingID int) (time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(listingExpiryDuration())
+	err := db.QueryRow(
+		`UPDATE listings SET expires_at = $1, expiry_reminder_sent_at = NULL, status = $2, updated_at = $3
+		WHERE id = $4 AND (status = $2 OR (status = $5 AND expires_at <= $3))
+		RETURNING expires_at`,
+		expiresAt, StatusActive, now, listingID, StatusArchived,
+	).Scan(&expiresAt)
+	return expiresAt, err
+}
+
+// renewListingHandler handles POST /listings/{id}/renew for the listing's owner.
+func renewListingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	l, ok := requireListingOwner(w, listingID, currentUserID)
+	if !ok {
+		return
+	}
+
+	action := RevisionEdit
+	if l.Status != StatusActive {
+		action = RevisionStatus
+	}
+	recordRenew := trackListingChange(listingID, currentUserID, action)
+	expiresAt, err := renewListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only active or expired listings can be renewed", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordRenew()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Listing renewed successfully",
+		"expiresAt": expiresAt,
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportedImage describes a listing image in an export. The image data
+// itself is left out.
+type ExportedImage struct {
+	ID          int    `json:"id"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+}
+
+// ExportedListing is one row of a seller's listings export.
+type ExportedListing struct {
+	ID                 int                    `json:"id"`
+	ProductName        string                 `json:"productName"`
+	ProductDescription string                 `json:"productDescription"`
+	Price              *Money                 `json:"price"`
+	Category           string                 `json:"category"`
+	Status             string                 `json:"status"`
+	Attributes         map[string]interface{} `json:"attributes"`
+	CreatedAt          time.Time              `json:"createdAt"`
+	UpdatedAt          time.Time              `json:"updatedAt"`
+	ExpiresAt          *time.Time             `json:"expiresAt"`
+	Images             []ExportedImage        `json:"images"`
+}
+
+// exportListingsSQL selects every listing of the user bound to $1, in every
+// status so that sold items form the sales history, with image metadata
+// aggregated per listing.
+const exportListingsSQL = `
+SELECT l.id, l.product_name, COALESCE(l.product_description, ''), l.price, COALESCE(l.category, ''), l.status,
+	l.attributes, l.created_at, l.updated_at, l.expires_at,
+	(SELECT COALESCE(json_agg(json_build_object('id', i.id, 'contentType', i.content_type, 'size', octet_length(i.image_data)) ORDER BY i.id), '[]')
+		FROM listing_images i WHERE i.listing_id = l.id)
+FROM listings l
+WHERE l.user_id = $1 AND l.deleted_at IS NULL
+ORDER BY l.created_at DESC, l.id DESC`
+
+// exportCSVHeader is the header row of a CSV export. Attributes are written
+// as a JSON object and images as "|"-separated ids.
+var exportCSVHeader = []string{
+	"id", "product_name", "product_description", "price", "category", "status", "attributes",
+	"created_at", "updated_at", "expires_at", "image_count", "image_ids",
+}
+
+// csvFormulaPrefixes are the leading characters that make spreadsheet apps
+// treat a cell as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell escapes a value that a spreadsheet would evaluate as a formula by
+// prefixing it with a single quote.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune(csvFormulaPrefixes, rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// csvRecord flattens an exported listing into a CSV row matching exportCSVHeader.
+// Seller-written fields are escaped with csvCell.
+func (l ExportedListing) csvRecord() []string {
+	attributes, _ := json.Marshal(l.Attributes)
+	price := ""
+	if l.Price != nil {
+		price = l.Price.String()
+	}
+	expiresAt := ""
+	if l.ExpiresAt != nil {
+		expiresAt = l.ExpiresAt.Format(time.RFC3339)
+	}
+	imageIDs := make([]string, len(l.Images))
+	for i, img := range l.Images {
+		imageIDs[i] = strconv.Itoa(img.ID)
+	}
+	return []string{
+		strconv.Itoa(l.ID),
+		csvCell(l.ProductName),
+		csvCell(l.ProductDescription),
+		price,
+		csvCell(l.Category),
+		l.Status,
+		csvCell(string(attributes)),
+		l.CreatedAt.Format(time.RFC3339),
+		l.UpdatedAt.Format(time.RFC3339),
+		expiresAt,
+		strconv.Itoa(len(l.Images)),
+		strings.Join(imageIDs, "|"),
+	}
+}
+
+// exportListingsHandler handles GET /listings/user/export?format=csv|json.
+// Rows are written to the response as they are read from the database, so
+// large exports are never held in memory.
+func exportListingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(exportListingsSQL, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"listings.%s\"", format))
+
+	// Once the first byte is written the status is 200, so errors from here
+	// on can only be logged and end the stream early.
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write(exportCSVHeader)
+	} else {
+		w.Write([]byte("["))
+	}
+
+	count := 0
+	for rows.Next() {
+		var l ExportedListing
+		var attributes, images []byte
+		if err := rows.Scan(&l.ID, &l.ProductName, &l.ProductDescription, &l.Price, &l.Category, &l.Status,
+			&attributes, &l.CreatedAt, &l.UpdatedAt, &l.ExpiresAt, &images); err != nil {
+			log.Printf("Error exporting listings for user %d: %v", userID, err)
+			return
+		}
+		if err := json.Unmarshal(attributes, &l.Attributes); err != nil {
+			log.Printf("Error exporting listing %d attributes: %v", l.ID, err)
+			return
+		}
+		if err := json.Unmarshal(images, &l.Images); err != nil {
+			log.Printf("Error exporting listing %d images: %v", l.ID, err)
+			return
+		}
+
+		if csvWriter != nil {
+			csvWriter.Write(l.csvRecord())
+		} else {
+			if count > 0 {
+				w.Write([]byte(","))
+			}
+			data, _ := json.Marshal(l)
+			w.Write(data)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error exporting listings for user %d: %v", userID, err)
+		return
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			log.Printf("Error writing listings export for user %d: %v", userID, err)
+		}
+	} else {
+		w.Write([]byte("]"))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportListingsHandler(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"id", "product_name", "product_description", "price", "category", "status",
+		"attributes", "created_at", "updated_at", "expires_at", "images"}
+
+	newMock := func(t *testing.T) sqlmock.Sqlmock {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock DB: %v", err)
+		}
+		originalDB := db
+		db = mockDB
+		t.Cleanup(func() {
+			db = originalDB
+			mockDB.Close()
+		})
+		mock.ExpectQuery("SELECT l.id, l.product_name").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, "Desk, oak", "", 40.0, "furniture", StatusSold, []byte(`{"condition":"good"}`), created, created, nil,
+					[]byte(`[{"id":3,"contentType":"image/png","size":120},{"id":4,"contentType":"image/jpeg","size":80}]`)).
+				AddRow(8, "=HYPERLINK(\"http://evil.example\")", "-5% off", 12.5, "furniture", StatusActive, []byte(`{}`), created, created, created, []byte(`[]`)))
+		return mock
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		mock := newMock(t)
+		req := httptest.NewRequest(http.MethodGet, "/listings/user/export?format=csv", nil)
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+
+		exportListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		records, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, exportCSVHeader, records[0])
+		assert.Equal(t, []string{"7", "Desk, oak", "", "40.00", "furniture", StatusSold, `{"condition":"good"}`,
+			"2025-03-01T12:00:00Z", "2025-03-01T12:00:00Z", "", "2", "3|4"}, records[1])
+		// Cells that a spreadsheet would run as formulas are quoted.
+		assert.Equal(t, `'=HYPERLINK("http://evil.example")`, records[2][1])
+		assert.Equal(t, "'-5% off", records[2][2])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		mock := newMock(t)
+		req := httptest.NewRequest(http.MethodGet, "/listings/user/export?format=json", nil)
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+
+		exportListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var listings []ExportedListing
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listings))
+		assert.Len(t, listings, 2)
+		assert.Equal(t, []ExportedImage{{ID: 3, ContentType: "image/png", Size: 120}, {ID: 4, ContentType: "image/jpeg", Size: 80}}, listings[0].Images)
+		assert.NotNil(t, listings[1].ExpiresAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/listings/user/export?format=xml", nil)
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+
+		exportListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
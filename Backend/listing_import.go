@@ -0,0 +1,674 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Limits for a single import request. The image limits apply to the whole
+// import, across rows, and importDeadline bounds the time spent on it.
+const (
+	maxImportRequestSize    = 64 << 20
+	maxImportRows           = 500
+	maxImportRowImages      = maxListingImages
+	maxImportImageSize      = 5 << 20
+	maxImportImages         = 100
+	maxImportImageBytes     = 100 << 20
+	maxImportImageRedirects = 3
+	importImageURLTimeout   = 10 * time.Second
+	importDeadline          = 2 * time.Minute
+)
+
+// importRow is one listing as read from an import file, before validation.
+// Images are URLs or the names of files in the uploaded zip.
+type importRow struct {
+	ProductName string
+	Description string
+	Price       string
+	Category    string
+	Images      []string
+}
+
+// importImage is an image that has been fetched and checked.
+type importImage struct {
+	Data        []byte
+	ContentType string
+}
+
+// importListing is a validated import row, ready to insert.
+type importListing struct {
+	ProductName string
+	Description string
+	Price       Money
+	Category    string
+	Attributes  []byte
+	Images      []importImage
+}
+
+// ImportRowResult reports the outcome of one row. Rows are numbered from 1,
+// not counting the CSV header. Screening is set when the row was flagged or
+// rejected by content screening, and Duplicate when it duplicates an
+// existing listing; both rejections are also listed in Errors.
+type ImportRowResult struct {
+	Row       int              `json:"row"`
+	ListingID int              `json:"listingId,omitempty"`
+	Errors    []string         `json:"errors,omitempty"`
+	Screening *ScreeningResult `json:"screening,omitempty"`
+	Duplicate *DuplicateMatch  `json:"duplicate,omitempty"`
+	// DuplicateOfRow is set when the row repeats an earlier row of the file.
+	DuplicateOfRow int `json:"duplicateOfRow,omitempty"`
+}
+
+// ImportReport is the response of POST /listings/import. Nothing is
+// imported unless every row is valid. Flagged counts imported rows queued
+// for moderators.
+type ImportReport struct {
+	Imported int               `json:"imported"`
+	Failed   int               `json:"failed"`
+	Flagged  int               `json:"flagged"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// importColumns maps the accepted CSV headers to importRow fields.
+var importColumns = map[string]string{
+	"product_name":        "product_name",
+	"productname":         "product_name",
+	"name":                "product_name",
+	"description":         "description",
+	"product_description": "description",
+	"price":               "price",
+	"category":            "category",
+	"images":              "images",
+	"image_urls":          "images",
+}
+
+// parseImportCSV reads rows from a CSV file with a header line. The images
+// column holds image URLs or zip file names separated by "|" or ";".
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		column, ok := importColumns[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", h)
+		}
+		columns[i] = column
+		seen[column] = true
+	}
+	for _, required := range []string{"product_name", "price", "category"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		var row importRow
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case "product_name":
+				row.ProductName = value
+			case "description":
+				row.Description = value
+			case "price":
+				row.Price = value
+			case "category":
+				row.Category = value
+			case "images":
+				for _, ref := range strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ';' }) {
+					if ref = strings.TrimSpace(ref); ref != "" {
+						row.Images = append(row.Images, ref)
+					}
+				}
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("too many rows, the limit is %d", maxImportRows)
+		}
+	}
+	return rows, nil
+}
+
+// parseImportJSON reads rows from a JSON array of objects with the keys
+// product_name, description, price, category and images.
+func parseImportJSON(r io.Reader) ([]importRow, error) {
+	var items []struct {
+		ProductName string      `json:"product_name"`
+		Description string      `json:"description"`
+		Price       json.Number `json:"price"`
+		Category    string      `json:"category"`
+		Images      []string    `json:"images"`
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&items); err != nil {
+		return nil, fmt.Errorf("invalid JSON: expected an array of listings")
+	}
+	if len(items) > maxImportRows {
+		return nil, fmt.Errorf("too many rows, the limit is %d", maxImportRows)
+	}
+
+	rows := make([]importRow, len(items))
+	for i, item := range items {
+		rows[i] = importRow{
+			ProductName: strings.TrimSpace(item.ProductName),
+			Description: strings.TrimSpace(item.Description),
+			Price:       item.Price.String(),
+			Category:    strings.TrimSpace(item.Category),
+			Images:      item.Images,
+		}
+	}
+	return rows, nil
+}
+
+// readImportZip indexes the images in an uploaded zip by file name.
+// Directories inside the archive are ignored, so "photos/lamp.jpg" is
+// referenced as "lamp.jpg".
+func readImportZip(fileHeader *multipart.FileHeader) (map[string]*zip.File, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, fileHeader.Size)
+	if err != nil {
+		return nil, fmt.Errorf("images must be a zip archive")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files[path.Base(f.Name)] = f
+	}
+	return files, nil
+}
+
+// readZipImage reads and checks one image from the uploaded zip.
+func readZipImage(f *zip.File) (importImage, error) {
+	if f.UncompressedSize64 > maxImportImageSize {
+		return importImage{}, fmt.Errorf("image %q is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return importImage{}, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxImportImageSize+1))
+	if err != nil {
+		return importImage{}, err
+	}
+	return checkImportImage(f.Name, data)
+}
+
+// errImportAddressBlocked is returned when an image URL points at an
+// address the server must not connect to.
+var errImportAddressBlocked = errors.New("address is not allowed")
+
+// importBlockedNetworks are non-public ranges not covered by the net.IP
+// predicates used in isPublicImportIP.
+var importBlockedNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "this" network
+		"100.64.0.0/10",  // carrier-grade NAT
+		"192.0.0.0/24",   // IETF protocol assignments
+		"198.18.0.0/15",  // benchmarking
+		"240.0.0.0/4",    // reserved, including broadcast
+		"64:ff9b::/96",   // NAT64, which can reach IPv4 private ranges
+		"64:ff9b:1::/48", // local-use NAT64
+		"2001:db8::/32",  // documentation
+		"fec0::/10",      // deprecated site-local
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPublicImportIP reports whether import images may be downloaded from ip.
+// Private, loopback, link-local (which includes cloud metadata endpoints
+// such as 169.254.169.254) and other non-public addresses are refused.
+func isPublicImportIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range importBlockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// importAddressAllowed decides which addresses import images may come from.
+var importAddressAllowed = isPublicImportIP
+
+// importDialControl runs after DNS resolution and before every connection,
+// including the ones made for redirects, so a hostname that resolves to a
+// private address is refused too.
+func importDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !importAddressAllowed(ip) {
+		return fmt.Errorf("%w: %s", errImportAddressBlocked, host)
+	}
+	return nil
+}
+
+// checkImportImageURL checks the scheme and, for IP literals, the address
+// of an image URL before it is requested.
+func checkImportImageURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !importAddressAllowed(ip) {
+		return fmt.Errorf("%w: %s", errImportAddressBlocked, ip)
+	}
+	return nil
+}
+
+// importHTTPClient downloads import images. It never uses a proxy, so the
+// dial check sees the real destination, and it follows at most
+// maxImportImageRedirects redirects, checking each one.
+var importHTTPClient = &http.Client{
+	Timeout: importImageURLTimeout,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: importImageURLTimeout, Control: importDialControl}).DialContext,
+		TLSHandshakeTimeout:   importImageURLTimeout,
+		ResponseHeaderTimeout: importImageURLTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxImportImageRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxImportImageRedirects)
+		}
+		return checkImportImageURL(req.URL)
+	},
+}
+
+// fetchImportImage downloads an image referenced by URL in an import file.
+var fetchImportImage = func(ctx context.Context, rawURL string) (importImage, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil {
+		err = checkImportImageURL(u)
+	}
+	if err != nil {
+		return importImage{}, fmt.Errorf("could not download image %q: %v", rawURL, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return importImage{}, fmt.Errorf("could not download image %q", rawURL)
+	}
+	resp, err := importHTTPClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errImportAddressBlocked) {
+			return importImage{}, fmt.Errorf("could not download image %q: %v", rawURL, errImportAddressBlocked)
+		}
+		return importImage{}, fmt.Errorf("could not download image %q", rawURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return importImage{}, fmt.Errorf("could not download image %q: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportImageSize+1))
+	if err != nil {
+		return importImage{}, fmt.Errorf("could not download image %q", rawURL)
+	}
+	return checkImportImage(rawURL, data)
+}
+
+// importBudget counts the images an import has loaded against the limits
+// for the whole import.
+type importBudget struct {
+	images int
+	bytes  int
+}
+
+// reserve claims one image before it is loaded.
+func (b *importBudget) reserve() error {
+	if b.images >= maxImportImages {
+		return fmt.Errorf("the import has more than %d images", maxImportImages)
+	}
+	if b.bytes > maxImportImageBytes {
+		return fmt.Errorf("the import's images exceed %d MB", maxImportImageBytes>>20)
+	}
+	b.images++
+	return nil
+}
+
+// add counts the size of a loaded image.
+func (b *importBudget) add(img importImage) error {
+	b.bytes += len(img.Data)
+	if b.bytes > maxImportImageBytes {
+		return fmt.Errorf("the import's images exceed %d MB", maxImportImageBytes>>20)
+	}
+	return nil
+}
+
+// checkImportImage enforces the size limit and that the data is an image.
+func checkImportImage(name string, data []byte) (importImage, error) {
+	if len(data) > maxImportImageSize {
+		return importImage{}, fmt.Errorf("image %q is too large", name)
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return importImage{}, fmt.Errorf("%q is not an image", name)
+	}
+	return importImage{Data: data, ContentType: contentType}, nil
+}
+
+// validateImportRow checks one row the same way a single listing POST is
+// checked and resolves its images within the import's budget. It returns
+// every problem found rather than stopping at the first.
+func validateImportRow(ctx context.Context, row importRow, zipFiles map[string]*zip.File, budget *importBudget) (importListing, []string) {
+	var errs []string
+	l := importListing{ProductName: row.ProductName, Description: row.Description}
+
+	if l.ProductName == "" {
+		errs = append(errs, "product_name is required")
+	}
+	price, err := parseMoney(row.Price)
+	if err != nil {
+		errs = append(errs, "invalid price: "+err.Error())
+	}
+	l.Price = price
+
+	if row.Category == "" {
+		errs = append(errs, "category is required")
+	} else if l.Category, err = resolveCategory(row.Category); err != nil {
+		errs = append(errs, "invalid category: "+err.Error())
+	} else if l.Attributes, err = resolveListingAttributes(l.Category, ""); err != nil {
+		errs = append(errs, "invalid attributes: "+err.Error())
+	}
+
+	if len(row.Images) > maxImportRowImages {
+		errs = append(errs, fmt.Sprintf("too many images, the limit is %d", maxImportRowImages))
+		return l, errs
+	}
+	for _, ref := range row.Images {
+		if err := budget.reserve(); err != nil {
+			errs = append(errs, err.Error())
+			break
+		}
+		var img importImage
+		if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+			img, err = fetchImportImage(ctx, ref)
+		} else if f, ok := zipFiles[path.Base(ref)]; ok {
+			img, err = readZipImage(f)
+		} else {
+			err = fmt.Errorf("image %q is not a URL or a file in the zip", ref)
+		}
+		if err == nil {
+			err = budget.add(img)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		l.Images = append(l.Images, img)
+	}
+	return l, errs
+}
+
+// importedRow is a row accepted earlier in the same import. The rows are
+// not visible to the duplicate lookup until the import commits, so later
+// rows are also compared against these.
+type importedRow struct {
+	Row         int
+	ProductName string
+	Price       Money
+	ImageHashes []string
+}
+
+// checkImportRow runs the content screening and duplicate check that a
+// single listing POST gets, against existing listings and the rows accepted
+// so far. Rejections are returned as row errors; an accepted row is added
+// to accepted.
+func checkImportRow(userID int, l importListing, accepted *[]importedRow, result *ImportRowResult) error {
+	screening := screenListingContent(listingContent{Name: l.ProductName, Description: l.Description})
+	if screening.Verdict != ScreenAllow {
+		result.Screening = &screening
+	}
+	if screening.Verdict == ScreenReject {
+		result.Errors = append(result.Errors, "rejected: "+strings.Join(screening.Reasons, "; "))
+		return nil
+	}
+
+	hashes := make([]string, len(l.Images))
+	for i, img := range l.Images {
+		hashes[i] = imageContentHash(img.Data)
+	}
+	candidates, err := findDuplicateCandidates(userID, time.Now().Add(-duplicateWindow()), hashes)
+	if err != nil {
+		return err
+	}
+	if duplicate := matchDuplicate(userID, l.ProductName, l.Price, candidates); duplicate != nil {
+		result.Duplicate = duplicate
+		result.Errors = append(result.Errors, fmt.Sprintf("duplicate of listing %d: it %s", duplicate.ListingID, strings.Join(duplicate.Reasons, " and ")))
+		return nil
+	}
+
+	earlier := make([]duplicateCandidate, len(*accepted))
+	for i, a := range *accepted {
+		earlier[i] = duplicateCandidate{ID: a.Row, UserID: userID, ProductName: a.ProductName, Price: a.Price, SameImage: sharesImageHash(hashes, a.ImageHashes)}
+	}
+	if duplicate := matchDuplicate(userID, l.ProductName, l.Price, earlier); duplicate != nil {
+		result.DuplicateOfRow = duplicate.ListingID
+		result.Errors = append(result.Errors, fmt.Sprintf("duplicate of row %d: it %s", duplicate.ListingID, strings.Join(duplicate.Reasons, " and ")))
+		return nil
+	}
+	*accepted = append(*accepted, importedRow{Row: result.Row, ProductName: l.ProductName, Price: l.Price, ImageHashes: hashes})
+	return nil
+}
+
+// sharesImageHash reports whether the two lists have a hash in common.
+func sharesImageHash(a, b []string) bool {
+	for _, x := range a {
+		if slices.Contains(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertImportedListing inserts one listing and its images as part of the
+// import's transaction and returns its id.
+var insertImportedListing = func(tx *sql.Tx, userID int, l importListing, now time.Time) (int, error) {
+	var id int
+	err := tx.QueryRow(
+		"INSERT INTO listings(user_id, product_name, product_description, price, category, attributes, status, created_at, updated_at, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $8, $9) RETURNING id",
+		userID, l.ProductName, l.Description, l.Price, l.Category, l.Attributes, StatusActive, now, now.Add(listingExpiryDuration()),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	for _, img := range l.Images {
+		if _, err := tx.Exec(
+			"INSERT INTO listing_images(listing_id, image_data, content_type) VALUES($1, $2, $3)",
+			id, img.Data, img.ContentType,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// importListingsHandler handles POST /listings/import. The multipart form
+// carries the listings in "file" (CSV or JSON, chosen by the "format" field
+// or the file extension) and optionally an "images" zip. Rows are checked
+// like single listings, including screening and the duplicate check, and
+// each valid row is written as soon as it is checked so that its images
+// need not be held. Everything is one transaction: if any row fails,
+// nothing is imported and the report lists the errors.
+func importListingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportRequestSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Unable to parse form data", http.StatusBadRequest)
+		return
+	}
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing import file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	}
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = parseImportCSV(file)
+	case "json":
+		rows, err = parseImportJSON(file)
+	default:
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(w, "No listings to import", http.StatusBadRequest)
+		return
+	}
+
+	var zipFiles map[string]*zip.File
+	if zipHeaders := r.MultipartForm.File["images"]; len(zipHeaders) > 0 {
+		zipFiles, err = readImportZip(zipHeaders[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), importDeadline)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	budget := &importBudget{}
+	var accepted []importedRow
+	report := ImportReport{Rows: make([]ImportRowResult, len(rows))}
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		if ctx.Err() != nil {
+			http.Error(w, fmt.Sprintf("Import did not finish within %v; nothing was imported", importDeadline), http.StatusGatewayTimeout)
+			return
+		}
+		result := ImportRowResult{Row: i + 1}
+		l, errs := validateImportRow(ctx, row, zipFiles, budget)
+		result.Errors = errs
+		if len(result.Errors) == 0 {
+			if err := checkImportRow(userID, l, &accepted, &result); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		report.Rows[i] = result
+		if len(result.Errors) > 0 {
+			report.Failed++
+			continue
+		}
+		// Once a row has failed nothing will be committed, so later rows
+		// are only checked.
+		if report.Failed == 0 {
+			if ids[i], err = insertImportedListing(tx, userID, l, now); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Failed > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i, id := range ids {
+		result := &report.Rows[i]
+		result.ListingID = id
+		recordListingCreated(id, userID)
+		if result.Screening != nil && result.Screening.Verdict == ScreenFlag {
+			flagListingForReview(id, result.Screening.Reasons)
+			report.Flagged++
+		}
+		go listingPublished(id)
+	}
+	report.Imported = len(ids)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// pngHeader is enough for http.DetectContentType to report image/png.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+func TestParseImportCSV(t *testing.T) {
+	rows, err := parseImportCSV(strings.NewReader(
+		"Product_Name,description,price,category,images\n" +
+			"Desk lamp,\"Bright, adjustable\",12.50,Furniture,https://example.com/a.png|lamp.png\n" +
+			"Mini fridge,,80,appliances,\n"))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, importRow{
+		ProductName: "Desk lamp",
+		Description: "Bright, adjustable",
+		Price:       "12.50",
+		Category:    "Furniture",
+		Images:      []string{"https://example.com/a.png", "lamp.png"},
+	}, rows[0])
+	assert.Empty(t, rows[1].Images)
+
+	_, err = parseImportCSV(strings.NewReader("product_name,price\nLamp,10\n"))
+	assert.EqualError(t, err, `missing column "category"`)
+	_, err = parseImportCSV(strings.NewReader("product_name,price,category,colour\n"))
+	assert.EqualError(t, err, `unknown column "colour"`)
+	_, err = parseImportCSV(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestParseImportJSON(t *testing.T) {
+	rows, err := parseImportJSON(strings.NewReader(
+		`[{"product_name": " Lamp ", "price": 12.5, "category": "furniture", "images": ["lamp.png"]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []importRow{{ProductName: "Lamp", Price: "12.5", Category: "furniture", Images: []string{"lamp.png"}}}, rows)
+
+	_, err = parseImportJSON(strings.NewReader(`{"product_name": "Lamp"}`))
+	assert.Error(t, err)
+}
+
+// stubImportLookups makes category, attribute, image and duplicate lookups
+// work without a database or network.
+func stubImportLookups(t *testing.T) {
+	originalResolve := resolveCategory
+	originalAttributes := getCategoryAttributes
+	originalFetch := fetchImportImage
+	originalCandidates := findDuplicateCandidates
+	t.Cleanup(func() {
+		resolveCategory = originalResolve
+		getCategoryAttributes = originalAttributes
+		fetchImportImage = originalFetch
+		findDuplicateCandidates = originalCandidates
+	})
+	findDuplicateCandidates = func(userID int, since time.Time, imageHashes []string) ([]duplicateCandidate, error) {
+		return []duplicateCandidate{{ID: 40, UserID: 1, ProductName: "Oak desk", Price: 4000}}, nil
+	}
+	resolveCategory = func(input string) (string, error) {
+		if strings.EqualFold(input, "furniture") {
+			return "furniture", nil
+		}
+		return "", fmt.Errorf("%w %q", errUnknownCategory, input)
+	}
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	fetchImportImage = func(ctx context.Context, url string) (importImage, error) {
+		if strings.HasSuffix(url, ".png") {
+			return importImage{Data: pngHeader, ContentType: "image/png"}, nil
+		}
+		return importImage{}, fmt.Errorf("could not download image %q", url)
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	stubImportLookups(t)
+
+	ctx := context.Background()
+	l, errs := validateImportRow(ctx, importRow{ProductName: "Lamp", Price: "10", Category: "Furniture",
+		Images: []string{"https://example.com/lamp.png"}}, nil, &importBudget{})
+	assert.Empty(t, errs)
+	assert.Equal(t, "furniture", l.Category)
+	assert.Equal(t, Money(1000), l.Price)
+	assert.Len(t, l.Images, 1)
+
+	_, errs = validateImportRow(ctx, importRow{Price: "-1", Category: "toys",
+		Images: []string{"https://example.com/missing.jpg", "lamp.png"}}, nil, &importBudget{})
+	assert.Len(t, errs, 5)
+
+	// Free listings have a price of zero.
+	l, errs = validateImportRow(ctx, importRow{ProductName: "Lamp", Price: "0", Category: "Furniture"}, nil, &importBudget{})
+	assert.Empty(t, errs)
+	assert.Equal(t, Money(0), l.Price)
+
+	// The image budget is shared by every row of an import.
+	budget := &importBudget{images: maxImportImages - 1}
+	l, errs = validateImportRow(ctx, importRow{ProductName: "Lamp", Price: "10", Category: "Furniture",
+		Images: []string{"https://example.com/a.png", "https://example.com/b.png"}}, nil, budget)
+	assert.Len(t, l.Images, 1)
+	assert.Equal(t, []string{fmt.Sprintf("the import has more than %d images", maxImportImages)}, errs)
+}
+
+func TestImportBudget(t *testing.T) {
+	b := &importBudget{}
+	assert.NoError(t, b.reserve())
+	assert.NoError(t, b.add(importImage{Data: make([]byte, maxImportImageBytes)}))
+	assert.NoError(t, b.reserve())
+	assert.Error(t, b.add(importImage{Data: []byte{1}}))
+	assert.Error(t, b.reserve())
+}
+
+func TestIsPublicImportIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0",
+		"100.64.0.1", "::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1", "64:ff9b::a00:1", "224.0.0.1"} {
+		assert.False(t, isPublicImportIP(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "2606:4700::1111"} {
+		assert.True(t, isPublicImportIP(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestFetchImportImage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lamp.png", func(w http.ResponseWriter, r *http.Request) { w.Write(pngHeader) })
+	mux.HandleFunc("/to-lamp", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/lamp.png", http.StatusFound) })
+	mux.HandleFunc("/to-private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/lamp.png", http.StatusFound)
+	})
+	mux.HandleFunc("/to-file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/loop", http.StatusFound) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	// The test server listens on loopback, which is refused by default.
+	_, err := fetchImportImage(ctx, server.URL+"/lamp.png")
+	assert.ErrorContains(t, err, "address is not allowed")
+	_, err = fetchImportImage(ctx, "http://169.254.169.254/latest/meta-data/")
+	assert.ErrorContains(t, err, "address is not allowed")
+
+	original := importAddressAllowed
+	defer func() { importAddressAllowed = original }()
+	importAddressAllowed = func(ip net.IP) bool { return ip.IsLoopback() }
+
+	img, err := fetchImportImage(ctx, server.URL+"/to-lamp")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+
+	// Every redirect is checked and they are capped.
+	_, err = fetchImportImage(ctx, server.URL+"/to-private")
+	assert.ErrorContains(t, err, "address is not allowed")
+	_, err = fetchImportImage(ctx, server.URL+"/to-file")
+	assert.Error(t, err)
+	_, err = fetchImportImage(ctx, server.URL+"/loop")
+	assert.Error(t, err)
+}
+
+// newImportRequest builds a multipart import request with the given file
+// and, when zipFiles is not nil, an images zip.
+func newImportRequest(t *testing.T, filename, content string, zipFiles map[string][]byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	if zipFiles != nil {
+		zipPart, _ := writer.CreateFormFile("images", "images.zip")
+		archive := zip.NewWriter(zipPart)
+		for name, data := range zipFiles {
+			f, _ := archive.Create(name)
+			f.Write(data)
+		}
+		assert.NoError(t, archive.Close())
+	}
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/listings/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("userId", "1")
+	return req
+}
+
+func TestImportListingsHandler(t *testing.T) {
+	stubImportLookups(t)
+	stubListingRevisions(t)
+	originalInsert := insertImportedListing
+	originalPublished := listingPublished
+	originalFlag := flagListingForReview
+	defer func() {
+		insertImportedListing = originalInsert
+		listingPublished = originalPublished
+		flagListingForReview = originalFlag
+	}()
+	listingPublished = func(listingID int) {}
+	flagged := map[int][]string{}
+	flagListingForReview = func(listingID int, reasons []string) { flagged[listingID] = reasons }
+
+	var inserted []importListing
+	insertImportedListing = func(tx *sql.Tx, userID int, l importListing, now time.Time) (int, error) {
+		inserted = append(inserted, l)
+		return 99 + len(inserted), nil
+	}
+	// mockTx expects the import's transaction to be committed or rolled back.
+	mockTx := func(t *testing.T, commit bool) sqlmock.Sqlmock {
+		mockDB, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		originalDB := db
+		db = mockDB
+		t.Cleanup(func() {
+			db = originalDB
+			mockDB.Close()
+		})
+		mock.ExpectBegin()
+		if commit {
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		return mock
+	}
+
+	t.Run("imports every row", func(t *testing.T) {
+		inserted = nil
+		mock := mockTx(t, true)
+		req := newImportRequest(t, "items.csv",
+			"product_name,price,category,images\nLamp,10,furniture,photos/lamp.png\nChair,15,Furniture,\n",
+			map[string][]byte{"photos/lamp.png": pngHeader})
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var report ImportReport
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 2, report.Imported)
+		assert.Equal(t, 100, report.Rows[0].ListingID)
+		assert.Equal(t, 101, report.Rows[1].ListingID)
+		assert.Len(t, inserted, 2)
+		assert.Len(t, inserted[0].Images, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("queues flagged rows for moderators", func(t *testing.T) {
+		inserted = nil
+		mock := mockTx(t, true)
+		req := newImportRequest(t, "items.json",
+			`[{"product_name": "Lamp", "price": 10, "category": "furniture"}, {"product_name": "Whiskey glasses", "price": 5, "category": "furniture"}]`, nil)
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var report ImportReport
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 2, report.Imported)
+		assert.Equal(t, 1, report.Flagged)
+		assert.Nil(t, report.Rows[0].Screening)
+		assert.Equal(t, ScreenFlag, report.Rows[1].Screening.Verdict)
+		assert.Equal(t, report.Rows[1].Screening.Reasons, flagged[101])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rejects screened and duplicate rows", func(t *testing.T) {
+		inserted = nil
+		mock := mockTx(t, false)
+		req := newImportRequest(t, "items.json",
+			`[{"product_name": "Hunting rifle", "price": 100, "category": "furniture"}, {"product_name": "oak desk", "price": 40, "category": "furniture"}]`, nil)
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		var report ImportReport
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 0, report.Imported)
+		assert.Equal(t, 2, report.Failed)
+		assert.Equal(t, ScreenReject, report.Rows[0].Screening.Verdict)
+		assert.Contains(t, report.Rows[0].Errors[0], "Weapons and ammunition")
+		assert.Equal(t, 40, report.Rows[1].Duplicate.ListingID)
+		assert.Equal(t, []string{"duplicate of listing 40: it has a similar title and price"}, report.Rows[1].Errors)
+		assert.Empty(t, inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rejects rows repeating an earlier row", func(t *testing.T) {
+		inserted = nil
+		mock := mockTx(t, false)
+		req := newImportRequest(t, "items.json",
+			`[{"product_name": "Desk lamp", "price": 10, "category": "furniture", "images": ["https://example.com/lamp.png"]},
+			{"product_name": "desk lamp", "price": 10, "category": "furniture"},
+			{"product_name": "Mirror", "price": 30, "category": "furniture", "images": ["https://example.com/mirror.png"]}]`, nil)
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		var report ImportReport
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 2, report.Failed)
+		assert.Empty(t, report.Rows[0].Errors)
+		assert.Equal(t, 1, report.Rows[1].DuplicateOfRow)
+		assert.Equal(t, []string{"duplicate of row 1: it has a similar title and price"}, report.Rows[1].Errors)
+		// The stubbed download returns the same bytes for every image.
+		assert.Equal(t, 1, report.Rows[2].DuplicateOfRow)
+		assert.Equal(t, []string{"duplicate of row 1: it uses the same photo"}, report.Rows[2].Errors)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rejects the whole file when a row is invalid", func(t *testing.T) {
+		inserted = nil
+		mock := mockTx(t, false)
+		req := newImportRequest(t, "items.json",
+			`[{"product_name": "Lamp", "price": 10, "category": "furniture"}, {"product_name": "", "price": 5, "category": "furniture"}]`, nil)
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		var report ImportReport
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 0, report.Imported)
+		assert.Equal(t, 1, report.Failed)
+		assert.Empty(t, report.Rows[0].Errors)
+		assert.Equal(t, []string{"product_name is required"}, report.Rows[1].Errors)
+		// The first row was written before the second failed, and is rolled back.
+		assert.Len(t, inserted, 1)
+		assert.Zero(t, report.Rows[0].ListingID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		req := newImportRequest(t, "items.xlsx", "", nil)
+		rr := httptest.NewRecorder()
+
+		importListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
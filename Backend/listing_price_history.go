@@ -0,0 +1,121 @@
+package main
+
+import (
+	"UFMarketPlace/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// defaultPriceDropAlertPercent is used when config.json leaves
+// listings.priceDropAlertPercent unset.
+const defaultPriceDropAlertPercent = 10
+
+// PriceChange is one entry in a listing's price history.
+type PriceChange struct {
+	OldPrice  Money     `json:"oldPrice"`
+	NewPrice  Money     `json:"newPrice"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// priceDropAlertPercent is the smallest drop, as a percentage of the old
+// price, that triggers an alert to the users who favorited the listing.
+func priceDropAlertPercent() float64 {
+	percent := appConfig.Listings.PriceDropAlertPercent
+	if percent <= 0 {
+		percent = defaultPriceDropAlertPercent
+	}
+	return percent
+}
+
+// initListingPriceHistoryDB creates the listing_price_history table.
+func initListingPriceHistoryDB() error {
+	priceHistoryTable := `
+	CREATE TABLE IF NOT EXISTS listing_price_history (
+		id SERIAL PRIMARY KEY,
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		old_price NUMERIC(12,2) NOT NULL,
+		new_price NUMERIC(12,2) NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_listing_price_history_listing ON listing_price_history (listing_id, changed_at);`
+	if _, err := db.Exec(priceHistoryTable); err != nil {
+		return fmt.Errorf("error creating listing_price_history table: %v", err)
+	}
+	return nil
+}
+
+// insertPriceChange records a price change as part of the transaction that
+// updates the listing.
+func insertPriceChange(tx *sql.Tx, listingID int, oldPrice, newPrice Money, changedAt time.Time) error {
+	_, err := tx.Exec(
+		"INSERT INTO listing_price_history(listing_id, old_price, new_price, changed_at) VALUES($1, $2, $3, $4)",
+		listingID, oldPrice, newPrice, changedAt,
+	)
+	return err
+}
+
+// getPriceHistory returns a listing's price changes, oldest first.
+var getPriceHistory = func(listingID int) ([]PriceChange, error) {
+	rows, err := db.Query(
+		"SELECT old_price, new_price, changed_at FROM listing_price_history WHERE listing_id = $1 ORDER BY changed_at, id",
+		listingID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PriceChange{}
+	for rows.Next() {
+		var c PriceChange
+		if err := rows.Scan(&c.OldPrice, &c.NewPrice, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
+
+// isAlertablePriceDrop reports whether going from oldPrice to newPrice is a
+// drop of at least priceDropAlertPercent.
+func isAlertablePriceDrop(oldPrice, newPrice Money) bool {
+	if oldPrice <= 0 || newPrice >= oldPrice {
+		return false
+	}
+	return float64(oldPrice-newPrice)/float64(oldPrice)*100 >= priceDropAlertPercent()
+}
+
+// notifyPriceDrop emails everyone who favorited the listing, except its
+// seller, about a price drop. Failures are logged.
+var notifyPriceDrop = func(listingID int, productName string, oldPrice, newPrice Money) {
+	rows, err := db.Query(
+		`SELECT u.email FROM favorites f
+		JOIN users u ON u.id = f.user_id
+		JOIN listings l ON l.id = f.listing_id
+		WHERE f.listing_id = $1 AND f.user_id <> l.user_id`,
+		listingID,
+	)
+	if err != nil {
+		log.Printf("Error loading favorites for price drop on listing %d: %v", listingID, err)
+		return
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			log.Printf("Error loading favorites for price drop on listing %d: %v", listingID, err)
+			rows.Close()
+			return
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+
+	for _, email := range emails {
+		if err := utils.SendPriceDropAlert(email, productName, oldPrice.String(), newPrice.String()); err != nil {
+			log.Printf("Error sending price drop alert for listing %d: %v", listingID, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"UFMarketPlace/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAlertablePriceDrop(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+
+	appConfig.Listings.PriceDropAlertPercent = 0
+	assert.True(t, isAlertablePriceDrop(100, 90))
+	assert.False(t, isAlertablePriceDrop(100, 95))
+	assert.False(t, isAlertablePriceDrop(100, 120))
+	assert.False(t, isAlertablePriceDrop(0, 0))
+
+	appConfig.Listings.PriceDropAlertPercent = 25
+	assert.False(t, isAlertablePriceDrop(100, 80))
+	assert.True(t, isAlertablePriceDrop(100, 75))
+}
+
+func TestEditListingHandlerRecordsPriceChange(t *testing.T) {
+	stubListingRevisions(t)
+	originalGetListing := getListing
+	originalNotify := notifyPriceDrop
+	original := appConfig
+	defer func() {
+		getListing = originalGetListing
+		notifyPriceDrop = originalNotify
+		appConfig = original
+	}()
+	appConfig.Listings.PriceDropAlertPercent = 0
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive, ProductName: "Desk", Price: 4000, PriceSet: true}, nil
+	}
+	type alert struct {
+		listingID          int
+		productName        string
+		oldPrice, newPrice Money
+	}
+	alerts := make(chan alert, 1)
+	notifyPriceDrop = func(listingID int, productName string, oldPrice, newPrice Money) {
+		alerts <- alert{listingID, productName, oldPrice, newPrice}
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE listings SET price = \\$1, updated_at = \\$2 WHERE id = \\$3 AND user_id = \\$4").
+		WithArgs(Money(3000), sqlmock.AnyArg(), 3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO listing_price_history\\(listing_id, old_price, new_price, changed_at\\)").
+		WithArgs(3, Money(4000), Money(3000), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body, contentType := listingForm(t, map[string]string{"listingId": "3", "price": "30"})
+	req := httptest.NewRequest(http.MethodPut, "/listing/updateListing", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+
+	editListingHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	select {
+	case a := <-alerts:
+		assert.Equal(t, alert{3, "Desk", 4000, 3000}, a)
+	case <-time.After(time.Second):
+		t.Fatal("price drop alert was not sent")
+	}
+}
+
+func TestGetPriceHistory(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	changed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT old_price, new_price, changed_at FROM listing_price_history WHERE listing_id = \\$1 ORDER BY changed_at, id").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"old_price", "new_price", "changed_at"}).AddRow([]byte("40.00"), []byte("30.00"), changed))
+
+	history, err := getPriceHistory(3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PriceChange{{OldPrice: 4000, NewPrice: 3000, ChangedAt: changed}}, history)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotifyPriceDrop(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+	originalSend := utils.SendPriceDropAlert
+	defer func() { utils.SendPriceDropAlert = originalSend }()
+
+	var sent []string
+	utils.SendPriceDropAlert = func(to, productName, oldPrice, newPrice string) error {
+		sent = append(sent, fmt.Sprintf("%s %s %s->%s", to, productName, oldPrice, newPrice))
+		if to == "b@ufl.edu" {
+			return errors.New("smtp down")
+		}
+		return nil
+	}
+	// The seller is excluded in SQL, and one failed email does not stop the rest.
+	mock.ExpectQuery("SELECT u.email FROM favorites f .* WHERE f.listing_id = \\$1 AND f.user_id <> l.user_id").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("a@ufl.edu").AddRow("b@ufl.edu").AddRow("c@ufl.edu"))
+
+	notifyPriceDrop(3, "Desk", 4000, 2999)
+
+	assert.Equal(t, []string{
+		"a@ufl.edu Desk 40.00->29.99",
+		"b@ufl.edu Desk 40.00->29.99",
+		"c@ufl.edu Desk 40.00->29.99",
+	}, sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
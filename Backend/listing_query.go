@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// listingQuery composes the WHERE and ORDER BY clauses of a listings query.
+// Placeholders are numbered as conditions are added, the same way
+// editListingHandler numbers its SET list, so user input only ever reaches
+// the database as parameters.
+type listingQuery struct {
+	conditions []string
+	params     []interface{}
+	orderBy    string
+	// distance is the distance expression set by a near= filter, used by
+	// the distance sort and selected by distanceColumn.
+	distance string
+	// rank is the relevance expression of a full-text search, used by the
+	// relevance sort.
+	rank string
+}
+
+// where appends a condition. clause must contain one %d verb per argument,
+// each of which becomes a $n placeholder, e.g. "l.price >= $%d".
+func (q *listingQuery) where(clause string, args ...interface{}) {
+	indexes := make([]interface{}, len(args))
+	for i, arg := range args {
+		q.params = append(q.params, arg)
+		indexes[i] = len(q.params)
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(clause, indexes...))
+}
+
+// bind adds a parameter without a condition and returns its placeholder,
+// for use in the select list.
+func (q *listingQuery) bind(arg interface{}) string {
+	q.params = append(q.params, arg)
+	return fmt.Sprintf("$%d", len(q.params))
+}
+
+// distanceColumn returns an extra select column holding each listing's
+// distance from the near= point, or NULL when there is none. Scan it into
+// Listing.DistanceKm.
+func (q *listingQuery) distanceColumn() string {
+	if q.distance == "" {
+		return ", NULL::double precision"
+	}
+	return ", " + q.distance
+}
+
+// build appends the composed clauses and a LIMIT to base and returns the
+// final SQL together with its parameters.
+func (q *listingQuery) build(base string, limit int) (string, []interface{}) {
+	query := base
+	if len(q.conditions) > 0 {
+		query += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	if q.orderBy != "" {
+		query += " ORDER BY " + q.orderBy
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return query, q.params
+}
+
+// listingSort describes one supported ordering of the feed and the keyset
+// condition used to resume it from a cursor.
+type listingSort struct {
+	orderBy    string
+	keyset     string
+	byPrice    bool
+	byDistance bool
+	byRank     bool
+}
+
+const defaultListingSort = "newest"
+
+var listingSorts = map[string]listingSort{
+	"newest":     {orderBy: "l.created_at DESC, l.id DESC", keyset: "(l.created_at, l.id) < ($%d, $%d)"},
+	"oldest":     {orderBy: "l.created_at ASC, l.id ASC", keyset: "(l.created_at, l.id) > ($%d, $%d)"},
+	"price_asc":  {orderBy: "l.price ASC, l.id ASC", keyset: "(l.price, l.id) > ($%d, $%d)", byPrice: true},
+	"price_desc": {orderBy: "l.price DESC, l.id DESC", keyset: "(l.price, l.id) < ($%d, $%d)", byPrice: true},
+	// distance needs a near= filter; %[1]s is replaced by the distance expression.
+	"distance": {orderBy: "%[1]s ASC, l.id ASC", keyset: "(%[1]s, l.id) > ($%%d, $%%d)", byDistance: true},
+	// relevance is only used by search; %[1]s is replaced by the rank expression.
+	"relevance": {orderBy: "%[1]s DESC, l.id DESC", keyset: "(%[1]s, l.id) < ($%%d, $%%d)", byRank: true},
+}
+
+// paginate sets the ordering and, when a cursor is given, restricts the query
+// to rows after it. The cursor must have been issued for the same sort.
+func (q *listingQuery) paginate(sort string, cursor *listingCursor) error {
+	s, ok := listingSorts[sort]
+	if !ok {
+		return fmt.Errorf("invalid sort")
+	}
+	if s.byDistance {
+		if q.distance == "" {
+			return fmt.Errorf("sort=distance requires near")
+		}
+		s.orderBy = fmt.Sprintf(s.orderBy, q.distance)
+		s.keyset = fmt.Sprintf(s.keyset, q.distance)
+	}
+	if s.byRank {
+		if q.rank == "" {
+			return fmt.Errorf("sort=relevance requires a search query")
+		}
+		s.orderBy = fmt.Sprintf(s.orderBy, q.rank)
+		s.keyset = fmt.Sprintf(s.keyset, q.rank)
+	}
+	q.orderBy = s.orderBy
+	if cursor == nil {
+		return nil
+	}
+	if cursor.Sort != sort {
+		return fmt.Errorf("cursor does not match sort")
+	}
+	if s.byDistance {
+		q.where(s.keyset, cursor.Distance, cursor.ID)
+	} else if s.byRank {
+		q.where(s.keyset, cursor.Rank, cursor.ID)
+	} else if s.byPrice {
+		q.where(s.keyset, cursor.Price, cursor.ID)
+	} else {
+		q.where(s.keyset, cursor.CreatedAt, cursor.ID)
+	}
+	return nil
+}
+
+// listingFilter holds the optional feed filters from the query string.
+type listingFilter struct {
+	Category     string
+	MinPrice     *Money
+	MaxPrice     *Money
+	CreatedAfter *time.Time
+	SellerID     int
+	Statuses     []string
+	Attributes   map[string]string
+	Tags         []string
+	Near         *geoPoint
+	RadiusKm     float64
+	Sort         string
+}
+
+// parseListingFilter validates the category, minPrice, maxPrice,
+// createdAfter, sellerId, status, attr.<name>, tag, near, radiusKm and sort
+// query parameters. category is resolved to its slug the way a listing's
+// category is, so display names and aliases work too. status is a comma-separated list; when it is omitted the
+// feed shows publicListingStatuses. tag may be repeated or comma-separated and
+// matches listings carrying every tag given. near=lat,lon limits the feed to listings
+// picked up within radiusKm and sorts by distance unless another sort is given.
+func parseListingFilter(values url.Values) (listingFilter, error) {
+	f := listingFilter{
+		Category: strings.TrimSpace(values.Get("category")),
+		Sort:     defaultListingSort,
+	}
+	if f.Category != "" {
+		slug, err := resolveCategory(f.Category)
+		if err != nil {
+			return f, fmt.Errorf("invalid category: %w", err)
+		}
+		f.Category = slug
+	}
+
+	parsePrice := func(name string) (*Money, error) {
+		raw := values.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		v, err := parseMoney(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		return &v, nil
+	}
+	var err error
+	if f.MinPrice, err = parsePrice("minPrice"); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = parsePrice("maxPrice"); err != nil {
+		return f, err
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, fmt.Errorf("minPrice must not exceed maxPrice")
+	}
+
+	if raw := values.Get("createdAfter"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			// Also accept a plain date such as 2025-03-01.
+			t, err = time.Parse("2006-01-02", raw)
+			if err != nil {
+				return f, fmt.Errorf("invalid createdAfter")
+			}
+		}
+		f.CreatedAfter = &t
+	}
+
+	if raw := values.Get("sellerId"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 1 {
+			return f, fmt.Errorf("invalid sellerId")
+		}
+		f.SellerID = id
+	}
+
+	if raw := values.Get("status"); raw != "" {
+		for _, status := range strings.Split(raw, ",") {
+			status = strings.TrimSpace(status)
+			// Drafts are private to their owner and never appear on the feed.
+			if !isValidListingStatus(status) || status == StatusDraft {
+				return f, fmt.Errorf("invalid status")
+			}
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+
+	// Attribute filters are passed as attr.<name>=<value>, e.g. attr.condition=new.
+	for key := range values {
+		name, ok := strings.CutPrefix(key, "attr.")
+		if !ok {
+			continue
+		}
+		if !attributeNamePattern.MatchString(name) {
+			return f, fmt.Errorf("invalid attribute filter %q", key)
+		}
+		if f.Attributes == nil {
+			f.Attributes = map[string]string{}
+		}
+		f.Attributes[name] = values.Get(key)
+	}
+
+	if f.Tags, err = parseTags(values["tag"]); err != nil {
+		return f, err
+	}
+
+	if raw := values.Get("near"); raw != "" {
+		point, err := parseGeoPoint(raw)
+		if err != nil {
+			return f, err
+		}
+		f.Near = &point
+		f.RadiusKm = defaultSearchRadiusKm
+		f.Sort = "distance"
+	}
+	if raw := values.Get("radiusKm"); raw != "" {
+		if f.Near == nil {
+			return f, fmt.Errorf("radiusKm requires near")
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 || v > maxSearchRadiusKm {
+			return f, fmt.Errorf("radiusKm must be between 0 and %d", maxSearchRadiusKm)
+		}
+		f.RadiusKm = v
+	}
+
+	if raw := values.Get("sort"); raw != "" {
+		s, ok := listingSorts[raw]
+		if !ok || s.byRank {
+			return f, fmt.Errorf("invalid sort")
+		}
+		if s.byDistance && f.Near == nil {
+			return f, fmt.Errorf("sort=distance requires near")
+		}
+		f.Sort = raw
+	}
+	return f, nil
+}
+
+// apply adds the filter's conditions to q.
+func (f listingFilter) apply(q *listingQuery) {
+	if f.Category != "" {
+		// Match the category and everything below it in the taxonomy.
+		q.where("l.category IN ("+categorySubtreeSQL+")", f.Category)
+	}
+	if f.MinPrice != nil {
+		q.where("l.price >= $%d", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		q.where("l.price <= $%d", *f.MaxPrice)
+	}
+	if f.CreatedAfter != nil {
+		q.where("l.created_at > $%d", *f.CreatedAfter)
+	}
+	if f.SellerID != 0 {
+		q.where("l.user_id = $%d", f.SellerID)
+	}
+	names := make([]string, 0, len(f.Attributes))
+	for name := range f.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		q.where("l.attributes ->> $%d = $%d", name, f.Attributes[name])
+	}
+	if len(f.Statuses) > 0 {
+		q.where("l.status = ANY($%d)", pq.Array(f.Statuses))
+	} else {
+		q.where("l.status = ANY($%d)", pq.Array(publicListingStatuses))
+	}
+	for _, tag := range f.Tags {
+		q.where("l.id IN (SELECT lt.listing_id FROM listing_tags lt JOIN tags t ON t.id = lt.tag_id WHERE t.name = $%d)", tag)
+	}
+	if f.Near != nil {
+		q.distance = haversineSQL(q.bind(f.Near.Lat), q.bind(f.Near.Lon))
+		// Listings without a pickup point have a NULL distance and drop out here.
+		q.where(q.distance+" <= $%d", f.RadiusKm)
+	}
+}
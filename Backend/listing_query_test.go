@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingQueryBuild(t *testing.T) {
+	minPrice := Money(500)
+	q := &listingQuery{}
+	q.where("l.user_id <> $%d", 7)
+	listingFilter{MinPrice: &minPrice, SellerID: 3}.apply(q)
+	cursor := &listingCursor{Sort: "price_asc", Price: 1250, ID: 9}
+	assert.NoError(t, q.paginate("price_asc", cursor))
+
+	query, params := q.build("SELECT l.id FROM listings l", 21)
+
+	assert.Equal(t, "SELECT l.id FROM listings l WHERE l.user_id <> $1 AND l.price >= $2 AND l.user_id = $3 AND l.status = ANY($4) AND (l.price, l.id) > ($5, $6) ORDER BY l.price ASC, l.id ASC LIMIT 21", query)
+	assert.Equal(t, []interface{}{7, Money(500), 3, pq.Array(publicListingStatuses), Money(1250), 9}, params)
+}
+
+func TestListingQueryBind(t *testing.T) {
+	q := &listingQuery{}
+	placeholder := q.bind(4)
+	q.where("l.user_id <> $%d", 4)
+
+	query, params := q.build("SELECT l.id, "+placeholder+" FROM listings l", 0)
+
+	assert.Equal(t, "SELECT l.id, $1 FROM listings l WHERE l.user_id <> $2", query)
+	assert.Equal(t, []interface{}{4, 4}, params)
+}
+
+func TestListingQueryCategoryIncludesSubtree(t *testing.T) {
+	q := &listingQuery{}
+	q.where("l.user_id <> $%d", 7)
+	listingFilter{Category: "books"}.apply(q)
+
+	query, params := q.build("SELECT l.id FROM listings l", 0)
+
+	assert.Contains(t, query, "l.category IN (WITH RECURSIVE subtree AS (SELECT id, slug FROM categories WHERE slug = $2 ")
+	assert.Equal(t, "books", params[1])
+}
+
+func TestListingQueryPaginateRejectsMismatchedCursor(t *testing.T) {
+	q := &listingQuery{}
+	err := q.paginate("newest", &listingCursor{Sort: "price_desc", ID: 1})
+	assert.Error(t, err)
+
+	assert.Error(t, q.paginate("cheapest", nil))
+}
+
+func TestListingQueryDistance(t *testing.T) {
+	q := &listingQuery{}
+	listingFilter{Near: &geoPoint{Lat: 29.65, Lon: -82.34}, RadiusKm: 5}.apply(q)
+	cursor := &listingCursor{Sort: "distance", Distance: 1.5, ID: 9}
+	assert.NoError(t, q.paginate("distance", cursor))
+
+	query, params := q.build("SELECT l.id"+q.distanceColumn()+" FROM listings l", 21)
+
+	distance := haversineSQL("$2", "$3")
+	assert.Equal(t, "SELECT l.id, "+distance+" FROM listings l WHERE l.status = ANY($1) AND "+distance+" <= $4 AND ("+distance+", l.id) > ($5, $6) ORDER BY "+distance+" ASC, l.id ASC LIMIT 21", query)
+	assert.Equal(t, []interface{}{pq.Array(publicListingStatuses), 29.65, -82.34, 5.0, 1.5, 9}, params)
+
+	assert.Error(t, (&listingQuery{}).paginate("distance", nil))
+	assert.Equal(t, ", NULL::double precision", (&listingQuery{}).distanceColumn())
+}
+
+func TestParseListingFilter(t *testing.T) {
+	originalResolve := resolveCategory
+	defer func() { resolveCategory = originalResolve }()
+	resolveCategory = func(input string) (string, error) {
+		if strings.EqualFold(input, "books") {
+			return "textbooks", nil
+		}
+		return "", fmt.Errorf("%w %q", errUnknownCategory, input)
+	}
+
+	f, err := parseListingFilter(url.Values{
+		"category":     {"Books"},
+		"minPrice":     {"10"},
+		"maxPrice":     {"50.5"},
+		"createdAfter": {"2025-03-01"},
+		"sellerId":     {"4"},
+		"status":       {"active,sold"},
+		"sort":         {"price_desc"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "textbooks", f.Category)
+	assert.Equal(t, Money(1000), *f.MinPrice)
+	assert.Equal(t, Money(5050), *f.MaxPrice)
+	assert.True(t, f.CreatedAfter.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 4, f.SellerID)
+	assert.Equal(t, []string{"active", "sold"}, f.Statuses)
+	assert.Equal(t, "price_desc", f.Sort)
+
+	f, err = parseListingFilter(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultListingSort, f.Sort)
+	assert.Nil(t, f.MinPrice)
+
+	f, err = parseListingFilter(url.Values{"near": {"29.65, -82.34"}})
+	assert.NoError(t, err)
+	assert.Equal(t, geoPoint{Lat: 29.65, Lon: -82.34}, *f.Near)
+	assert.Equal(t, float64(defaultSearchRadiusKm), f.RadiusKm)
+	assert.Equal(t, "distance", f.Sort)
+
+	f, err = parseListingFilter(url.Values{"near": {"29.65,-82.34"}, "radiusKm": {"2.5"}, "sort": {"price_asc"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, f.RadiusKm)
+	assert.Equal(t, "price_asc", f.Sort)
+
+	invalid := []url.Values{
+		{"category": {"Spaceships"}},
+		{"minPrice": {"abc"}},
+		{"minPrice": {"1.999"}},
+		{"maxPrice": {"-1"}},
+		{"minPrice": {"20"}, "maxPrice": {"10"}},
+		{"createdAfter": {"last week"}},
+		{"sellerId": {"0"}},
+		{"status": {"active,deleted"}},
+		{"status": {"draft"}},
+		{"sort": {"random"}},
+		{"near": {"29.65"}},
+		{"near": {"91,0"}},
+		{"radiusKm": {"5"}},
+		{"near": {"29.65,-82.34"}, "radiusKm": {"0"}},
+		{"near": {"29.65,-82.34"}, "radiusKm": {"501"}},
+		{"sort": {"distance"}},
+	}
+	for _, values := range invalid {
+		_, err := parseListingFilter(values)
+		assert.Error(t, err, values.Encode())
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Revision actions.
+const (
+	RevisionCreate  = "create"
+	RevisionEdit    = "edit"
+	RevisionStatus  = "status"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// ListingRevision is one entry in a listing's change history. Before is
+// null for creations.
+type ListingRevision struct {
+	ID        int             `json:"id"`
+	ListingID int             `json:"listingId"`
+	ActorID   *int            `json:"actorId"`
+	ActorName string          `json:"actorName"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// listingSnapshotSQL builds the JSON snapshot stored in listing_revisions
+// for the listing aliased as l. Image blobs are recorded by id only.
+const listingSnapshotSQL = `jsonb_build_object(
+	'productName', l.product_name,
+	'productDescription', l.product_description,
+	'price', l.price,
+	'category', l.category,
+	'status', l.status,
+	'attributes', l.attributes,
+	'expiresAt', l.expires_at,
+	'publishAt', l.publish_at,
+	'deletedAt', l.deleted_at,
+	'pickupLocationId', l.pickup_location_id,
+	'pickupLat', l.pickup_lat,
+	'pickupLon', l.pickup_lon,
+	'tags', to_jsonb(` + listingTagsSQL + `),
+	'imageIds', (SELECT COALESCE(jsonb_agg(i.id ORDER BY i.id), '[]'::jsonb) FROM listing_images i WHERE i.listing_id = l.id))`
+
+// initListingRevisionsDB creates the listing_revisions table. listing_id has
+// no foreign key so that history outlives the listing, and the owner is
+// copied so access can still be checked after a delete.
+func initListingRevisionsDB() error {
+	revisionsTable := `
+	CREATE TABLE IF NOT EXISTS listing_revisions (
+		id SERIAL PRIMARY KEY,
+		listing_id INTEGER NOT NULL,
+		listing_owner_id INTEGER NOT NULL,
+		actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		action TEXT NOT NULL,
+		before JSONB,
+		after JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_listing_revisions_listing ON listing_revisions (listing_id, created_at DESC);`
+	if _, err := db.Exec(revisionsTable); err != nil {
+		return fmt.Errorf("error creating listing_revisions table: %v", err)
+	}
+	return nil
+}
+
+// getListingSnapshot returns the listing's owner and its current snapshot.
+func getListingSnapshot(listingID int) (int, json.RawMessage, error) {
+	var ownerID int
+	var snapshot []byte
+	err := db.QueryRow("SELECT l.user_id, "+listingSnapshotSQL+" FROM listings l WHERE l.id = $1", listingID).Scan(&ownerID, &snapshot)
+	return ownerID, snapshot, err
+}
+
+// insertListingRevision stores a revision. An actorID of 0 marks a change
+// made by the system, such as a scheduled job.
+func insertListingRevision(listingID, ownerID, actorID int, action string, before, after json.RawMessage) error {
+	_, err := db.Exec(
+		`INSERT INTO listing_revisions(listing_id, listing_owner_id, actor_id, action, before, after, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		listingID, ownerID, sql.NullInt64{Int64: int64(actorID), Valid: actorID != 0}, action,
+		nullableJSON(before), nullableJSON(after), time.Now(),
+	)
+	return err
+}
+
+// nullableJSON maps an empty snapshot to SQL NULL.
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+// trackListingChange snapshots a listing before a change and returns a
+// function to call once the change has been made, which records the
+// before/after revision. Failures are logged rather than failing the request.
+var trackListingChange = func(listingID, actorID int, action string) func() {
+	ownerID, before, err := getListingSnapshot(listingID)
+	if err != nil {
+		log.Printf("Error snapshotting listing %d before %s: %v", listingID, action, err)
+		return func() {}
+	}
+	return func() {
+		_, after, err := getListingSnapshot(listingID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error snapshotting listing %d after %s: %v", listingID, action, err)
+			return
+		}
+		if err := insertListingRevision(listingID, ownerID, actorID, action, before, after); err != nil {
+			log.Printf("Error recording %s revision for listing %d: %v", action, listingID, err)
+		}
+	}
+}
+
+// recordListingCreated records the initial revision of a new listing.
+var recordListingCreated = func(listingID, actorID int) {
+	ownerID, after, err := getListingSnapshot(listingID)
+	if err == nil {
+		err = insertListingRevision(listingID, ownerID, actorID, RevisionCreate, nil, after)
+	}
+	if err != nil {
+		log.Printf("Error recording create revision for listing %d: %v", listingID, err)
+	}
+}
+
+// bulkStatusChangeSQL wraps an UPDATE ... RETURNING * over listings (passed
+// as the changed CTE) and records a system status revision for every row it
+// touched. The previous status is bound to $%d.
+func bulkStatusChangeSQL(update string, previousStatusParam int) string {
+	return fmt.Sprintf(`
+	WITH changed AS (%s RETURNING *)
+	INSERT INTO listing_revisions(listing_id, listing_owner_id, actor_id, action, before, after)
+	SELECT l.id, l.user_id, NULL, '%s', jsonb_set(s.snapshot, '{status}', to_jsonb($%d::text)), s.snapshot
+	FROM changed l, LATERAL (SELECT %s AS snapshot) s`,
+		update, RevisionStatus, previousStatusParam, listingSnapshotSQL)
+}
+
+// getListingRevisions returns a listing's history, newest first.
+var getListingRevisions = func(listingID int) ([]ListingRevision, error) {
+	rows, err := db.Query(
+		`SELECT r.id, r.listing_id, r.actor_id, COALESCE(u.name, ''), r.action, r.before, r.after, r.created_at
+		FROM listing_revisions r LEFT JOIN users u ON u.id = r.actor_id
+		WHERE r.listing_id = $1
+		ORDER BY r.created_at DESC, r.id DESC`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ListingRevision{}
+	for rows.Next() {
+		var rev ListingRevision
+		var actorID sql.NullInt64
+		var before, after []byte
+		if err := rows.Scan(&rev.ID, &rev.ListingID, &actorID, &rev.ActorName, &rev.Action, &before, &after, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			rev.ActorID = &id
+		}
+		rev.Before = nullableRaw(before)
+		rev.After = nullableRaw(after)
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// nullableRaw keeps SQL NULL as JSON null.
+func nullableRaw(b []byte) json.RawMessage {
+	if b == nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+// getListingOwnerForHistory returns the owner of a listing, falling back to
+// its revisions when the listing itself has been deleted.
+var getListingOwnerForHistory = func(listingID int) (int, error) {
+	var ownerID int
+	err := db.QueryRow(
+		`SELECT user_id FROM listings WHERE id = $1
+		UNION ALL
+		(SELECT listing_owner_id FROM listing_revisions WHERE listing_id = $1 ORDER BY id DESC LIMIT 1)
+		LIMIT 1`, listingID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// listingHistoryHandler handles GET /listings/{id}/history. Only the
+// listing's owner and admins may view it.
+func listingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := getListingOwnerForHistory(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ownerID != currentUserID {
+		role, err := GetUserRole(currentUserID)
+		if err != nil {
+			http.Error(w, "Error getting user details", http.StatusInternalServerError)
+			return
+		}
+		if role != RoleAdmin {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	revisions, err := getListingRevisions(listingID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
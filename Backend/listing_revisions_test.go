@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubListingRevisions disables revision recording for handler tests that
+// run without a database.
+func stubListingRevisions(t *testing.T) {
+	originalTrack := trackListingChange
+	originalCreated := recordListingCreated
+	t.Cleanup(func() {
+		trackListingChange = originalTrack
+		recordListingCreated = originalCreated
+	})
+	trackListingChange = func(listingID, actorID int, action string) func() { return func() {} }
+	recordListingCreated = func(listingID, actorID int) {}
+}
+
+func TestBulkStatusChangeSQL(t *testing.T) {
+	query := bulkStatusChangeSQL("UPDATE listings SET status = $1 WHERE status = $2", 2)
+	assert.Contains(t, query, "WITH changed AS (UPDATE listings SET status = $1 WHERE status = $2 RETURNING *)")
+	assert.Contains(t, query, "to_jsonb($2::text)")
+	assert.Contains(t, query, "'"+RevisionStatus+"'")
+}
+
+func TestListingHistoryHandler(t *testing.T) {
+	originalOwner := getListingOwnerForHistory
+	originalRole := GetUserRole
+	originalRevisions := getListingRevisions
+	defer func() {
+		getListingOwnerForHistory = originalOwner
+		GetUserRole = originalRole
+		getListingRevisions = originalRevisions
+	}()
+
+	getListingOwnerForHistory = func(listingID int) (int, error) {
+		if listingID == 404 {
+			return 0, sql.ErrNoRows
+		}
+		return 1, nil
+	}
+	GetUserRole = func(userID int) (string, error) {
+		if userID == 3 {
+			return RoleAdmin, nil
+		}
+		return RoleUser, nil
+	}
+	getListingRevisions = func(listingID int) ([]ListingRevision, error) {
+		return []ListingRevision{{ID: 1, ListingID: listingID, Action: RevisionCreate, Before: json.RawMessage("null"), After: json.RawMessage(`{"price":10}`)}}, nil
+	}
+
+	tests := []struct {
+		name           string
+		listingID      string
+		userID         string
+		expectedStatus int
+	}{
+		{"owner", "5", "1", http.StatusOK},
+		{"admin", "5", "3", http.StatusOK},
+		{"other user", "5", "2", http.StatusUnauthorized},
+		{"not found", "404", "1", http.StatusNotFound},
+		{"invalid id", "abc", "1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/listings/"+tt.listingID+"/history", nil)
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			listingHistoryHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.True(t, strings.Contains(rr.Body.String(), `"action":"create"`))
+			}
+		})
+	}
+}
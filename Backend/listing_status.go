@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Listing statuses.
+const (
+	StatusActive   = "active"
+	StatusReserved = "reserved"
+	StatusSold     = "sold"
+	StatusArchived = "archived"
+	StatusDraft    = "draft"
+)
+
+// publicListingStatuses are the statuses shown on the feed by default.
+var publicListingStatuses = []string{StatusActive, StatusReserved}
+
+// listingStatusTransitions lists the statuses each status may move to.
+var listingStatusTransitions = map[string][]string{
+	StatusActive:   {StatusReserved, StatusArchived},
+	StatusReserved: {StatusSold, StatusActive},
+	StatusSold:     {},
+	StatusArchived: {},
+	// Drafts leave this status through publishListingHandler, which checks
+	// that the listing is complete.
+	StatusDraft: {},
+}
+
+// isValidListingStatus reports whether status is a known listing status.
+func isValidListingStatus(status string) bool {
+	_, ok := listingStatusTransitions[status]
+	return ok
+}
+
+// canTransitionListingStatus reports whether a listing may move from one status to another.
+func canTransitionListingStatus(from, to string) bool {
+	for _, next := range listingStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// updateListingStatus moves a listing from one status to another. The
+// current status is part of the WHERE clause so that a concurrent change
+// makes this a no-op; it returns false in that case.
+var updateListingStatus = func(listingID int, from, to string) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE listings SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4",
+		to, time.Now(), listingID, from,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+type listingStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// listingStatusHandler handles PUT /listings/{id}/status so a seller can move
+// their listing through the active, reserved, sold and archived lifecycle.
+func listingStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	var req listingStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !isValidListingStatus(req.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	l, ok := requireListingOwner(w, listingID, currentUserID)
+	if !ok {
+		return
+	}
+	if !canTransitionListingStatus(l.Status, req.Status) {
+		http.Error(w, fmt.Sprintf("Cannot change status from %s to %s", l.Status, req.Status), http.StatusConflict)
+		return
+	}
+
+	recordStatus := trackListingChange(listingID, currentUserID, RevisionStatus)
+	updated, err := updateListingStatus(listingID, l.Status, req.Status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Listing status was changed by another request", http.StatusConflict)
+		return
+	}
+	recordStatus()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Listing status updated successfully",
+		"status":  req.Status,
+	})
+}
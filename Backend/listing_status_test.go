@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransitionListingStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusActive, StatusReserved, true},
+		{StatusActive, StatusArchived, true},
+		{StatusReserved, StatusSold, true},
+		{StatusReserved, StatusActive, true},
+		{StatusActive, StatusSold, false},
+		{StatusSold, StatusActive, false},
+		{StatusArchived, StatusActive, false},
+		{StatusReserved, StatusArchived, false},
+		{"unknown", StatusActive, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, canTransitionListingStatus(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestListingStatusHandler(t *testing.T) {
+	stubListingRevisions(t)
+	originalGetListing := getListing
+	originalUpdate := updateListingStatus
+	defer func() {
+		getListing = originalGetListing
+		updateListingStatus = originalUpdate
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		updated        bool
+		expectedStatus int
+	}{
+		{"Reserve active listing", "1", `{"status":"reserved"}`, true, http.StatusOK},
+		{"Invalid transition", "1", `{"status":"sold"}`, true, http.StatusConflict},
+		{"Unknown status", "1", `{"status":"gone"}`, true, http.StatusBadRequest},
+		{"Not the owner", "2", `{"status":"reserved"}`, true, http.StatusUnauthorized},
+		{"Concurrent change", "1", `{"status":"archived"}`, false, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updateListingStatus = func(listingID int, from, to string) (bool, error) {
+				return tt.updated, nil
+			}
+			req := httptest.NewRequest(http.MethodPut, "/listings/5/status", strings.NewReader(tt.body))
+			req.SetPathValue("id", "5")
+			req.Header.Set("userId", tt.userID)
+			w := httptest.NewRecorder()
+
+			listingStatusHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Listing represents a product listing.
@@ -24,13 +26,68 @@ type Listing struct {
 	UserEmail          string                   `json:"userEmail"`
 	ProductName        string                   `json:"productName"`
 	ProductDescription string                   `json:"productDescription"`
-	Price              float64                  `json:"price"`
+	Price              Money                    `json:"price"`
 	Category           string                   `json:"category"`
+	CategoryName       string                   `json:"categoryName"`
+	Status             string                   `json:"status"`
+	Attributes         map[string]interface{}   `json:"attributes"`
 	CreatedAt          time.Time                `json:"createdAt"`
 	UpdatedAt          time.Time                `json:"updatedAt"`
+	ExpiresAt          *time.Time               `json:"expiresAt"`
+	PublishAt          *time.Time               `json:"publishAt"`
+	PriceHistory       []PriceChange            `json:"priceHistory,omitempty"`
+	FavoriteCount      int                      `json:"favoriteCount"`
+	IsFavorited        bool                     `json:"isFavorited"`
 	Images             []map[string]interface{} `json:"images"`
-	UserAddress			string                   `json:"address"`
-	UserPhone           string                   `json:"phone"`
+	UserPhone          string                   `json:"phone"`
+	// PickupLocation replaces the seller's address, which is no longer exposed.
+	PickupLocation *PickupLocation `json:"pickupLocation"`
+	Tags           []string        `json:"tags"`
+	// DistanceKm is set when the feed is searched with near=.
+	DistanceKm *float64 `json:"distanceKm,omitempty"`
+	// Screening is set on a listing that was just created.
+	Screening *ScreeningResult `json:"screening,omitempty"`
+	// Duplicate is set on a listing that a new listing was merged into.
+	Duplicate *DuplicateMatch `json:"duplicate,omitempty"`
+	// PriceSet is false for a draft saved without a price.
+	PriceSet bool `json:"-"`
+}
+
+// maxListingImages is the most images a listing can have, whether it is
+// created, edited or merged into.
+const maxListingImages = 10
+
+// listingColumns is the select list read by scanListing. Queries using it
+// must alias listings as l, join users as u, left join categories as c and
+// left join pickup_locations as pl.
+const listingColumns = "l.id, l.user_id, u.name, u.email, u.phone, l.product_name, l.product_description, l.price, COALESCE(l.category, ''), COALESCE(c.name, ''), l.status, l.attributes, l.created_at, l.updated_at, l.expires_at, l.publish_at, l.pickup_location_id, COALESCE(pl.slug, ''), COALESCE(pl.name, ''), " + pickupLatSQL + ", " + pickupLonSQL + ", " + listingTagsSQL
+
+// listingFrom is the FROM clause matching listingColumns.
+const listingFrom = " FROM listings l JOIN users u ON u.id = l.user_id LEFT JOIN categories c ON c.slug = l.category LEFT JOIN pickup_locations pl ON pl.id = l.pickup_location_id"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanListing scans a row selected with listingColumns into l. Any extra
+// destinations are scanned from the columns that follow listingColumns.
+func scanListing(row rowScanner, l *Listing, extra ...interface{}) error {
+	var attributes []byte
+	var price sql.Null[Money]
+	var pickupID sql.NullInt64
+	var pickupSlug, pickupName string
+	var pickupLat, pickupLon sql.NullFloat64
+	dest := []interface{}{&l.ID, &l.UserID, &l.UserName, &l.UserEmail, &l.UserPhone, &l.ProductName, &l.ProductDescription, &price, &l.Category, &l.CategoryName, &l.Status, &attributes, &l.CreatedAt, &l.UpdatedAt, &l.ExpiresAt, &l.PublishAt,
+		&pickupID, &pickupSlug, &pickupName, &pickupLat, &pickupLon, pq.Array(&l.Tags)}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	l.Price, l.PriceSet = price.V, price.Valid
+	if pickupLat.Valid && pickupLon.Valid {
+		l.PickupLocation = &PickupLocation{ID: int(pickupID.Int64), Slug: pickupSlug, Name: pickupName, Lat: pickupLat.Float64, Lon: pickupLon.Float64}
+	}
+	return json.Unmarshal(attributes, &l.Attributes)
 }
 
 // saveImage saves an uploaded image to disk.
@@ -62,8 +119,10 @@ func saveImage(fileHeader *multipart.FileHeader) (string, error) {
 	return filePath, nil
 }
 
-// listingsHandler handles GET (fetch all listings excluding the current user)
+// listingsHandler handles GET (fetch a page of listings excluding the current user)
 // and POST (create new listing with multipart form data) requests.
+// GET accepts the limit and cursor query parameters plus the filters understood
+// by parseListingFilter, and returns a ListingsPage.
 func listingsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -79,10 +138,35 @@ func listingsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Join with users table to get the username
-		rows, err := db.Query(
-			"SELECT l.id, l.user_id, u.name, u.email, u.phone, u.address, l.product_name, l.product_description, l.price, l.category, l.created_at, l.updated_at "+
-				"FROM listings l JOIN users u ON u.id = l.user_id WHERE l.user_id <> $1", currentUserID)
+		limit, cursor, err := parsePageParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseListingFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q := &listingQuery{}
+		favoritedBy := q.bind(currentUserID)
+		q.where("l.user_id <> $%d", currentUserID)
+		q.where("l.deleted_at IS NULL")
+		// Listings with enough reports stay off the feed until a moderator reviews them.
+		q.where("l.hidden_at IS NULL")
+		filter.apply(q)
+		if err := q.paginate(filter.Sort, cursor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Join with users table to get the username. Favorite counts come
+		// from the same query rather than one lookup per row.
+		// Fetch one extra row to find out whether another page exists.
+		query, args := q.build("SELECT "+listingColumns+favoriteColumns(favoritedBy)+q.distanceColumn()+listingFrom, limit+1)
+
+		rows, err := db.Query(query, args...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -92,44 +176,17 @@ func listingsHandler(w http.ResponseWriter, r *http.Request) {
 		var listings []Listing
 		for rows.Next() {
 			var l Listing
-			var userName string
-			var userEmail string
-			var UserPhone string
-			var userAddress string
-
-			if err := rows.Scan(&l.ID, &l.UserID, &userName, &userEmail, &UserPhone, &userAddress, &l.ProductName, &l.ProductDescription, &l.Price, &l.Category, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			if err := scanListing(rows, &l, &l.FavoriteCount, &l.IsFavorited, &l.DistanceKm); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			l.UserName = userName
-			l.UserEmail = userEmail
-			l.UserAddress = userAddress
-			l.UserPhone = UserPhone
 
 			// Fetch image data for listing.
-			imageRows, err := db.Query("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = $1", l.ID)
-			if err == nil {
-				var images []map[string]interface{}
-				for imageRows.Next() {
-					var imageID int
-					var imageData []byte
-					var contentType string
-					if err := imageRows.Scan(&imageID, &imageData, &contentType); err == nil {
-						encodedData := base64.StdEncoding.EncodeToString(imageData)
-						images = append(images, map[string]interface{}{
-							"id":          imageID,
-							"contentType": contentType,
-							"data":        encodedData,
-						})
-					}
-				}
-				l.Images = images
-				imageRows.Close()
-			}
+			l.Images = fetchListingImages(l.ID)
 			listings = append(listings, l)
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(listings)
+		json.NewEncoder(w).Encode(newListingsPage(listings, limit, filter.Sort))
 
 	case http.MethodPost:
 		if err := r.ParseMultipartForm(10 << 20); err != nil {
@@ -149,28 +206,68 @@ func listingsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// A listing is saved as a draft when draft=true or a publishAt time is
+		// given. Drafts may leave out the name, price and category.
+		publishAt, err := parsePublishAt(r.FormValue("publishAt"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		isDraft := r.FormValue("draft") == "true" || publishAt != nil
+
 		productName := r.FormValue("productName")
 		productDescription := r.FormValue("productDescription")
 		priceStr := r.FormValue("price")
-		price, err := strconv.ParseFloat(priceStr, 64)
+		var price *Money
+		if priceStr != "" || !isDraft {
+			parsed, err := parseMoney(priceStr)
+			if err != nil {
+				http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			price = &parsed
+		}
+		var category string
+		if categoryStr := r.FormValue("category"); categoryStr != "" || !isDraft {
+			category, err = resolveCategory(categoryStr)
+			if err != nil {
+				http.Error(w, "Invalid category: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		attributes, err := resolveListingAttributes(category, r.FormValue("attributes"))
 		if err != nil {
-			http.Error(w, "Invalid price", http.StatusBadRequest)
+			http.Error(w, "Invalid attributes: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		category := r.FormValue("category")
-
-		var listingID int
-		err = db.QueryRow(
-			"INSERT INTO listings(user_id, product_name, product_description, price, category, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id",
-			userID, productName, productDescription, price, category, time.Now(), time.Now(),
-		).Scan(&listingID)
+		pickup, err := parsePickupForm(r.MultipartForm.Value)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Invalid pickup location: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		tags, _, err := parseTagsForm(r.MultipartForm.Value)
+		if err != nil {
+			http.Error(w, "Invalid tags: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(r.MultipartForm.File["images"]) > maxListingImages {
+			http.Error(w, fmt.Sprintf("A listing can have at most %d images", maxListingImages), http.StatusBadRequest)
+			return
+		}
+		if !isDraft || publishAt != nil {
+			if err := validateListingForPublish(Listing{ProductName: productName, Category: category, PriceSet: price != nil}); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		screening := screenListingContent(listingContent{Name: productName, Description: productDescription})
+		if screening.Verdict == ScreenReject {
+			http.Error(w, "Listing rejected: "+strings.Join(screening.Reasons, "; "), http.StatusUnprocessableEntity)
 			return
 		}
 
-		files := r.MultipartForm.File["images"]
-		for _, fileHeader := range files {
+		var images []listingImage
+		for _, fileHeader := range r.MultipartForm.File["images"] {
 			imageData, contentType, err := readImageData(fileHeader)
 			if err != nil {
 				log.Printf("Error reading image: %v", err)
@@ -181,60 +278,116 @@ func listingsHandler(w http.ResponseWriter, r *http.Request) {
 				log.Printf("Image too large: %s", fileHeader.Filename)
 				continue
 			}
+			images = append(images, listingImage{Data: imageData, ContentType: contentType})
+		}
 
-			_, err = db.Exec(
-				"INSERT INTO listing_images(listing_id, image_data, content_type) VALUES($1, $2, $3)",
-				listingID, imageData, contentType,
-			)
+		// Published listings are checked for duplicates. With
+		// onDuplicate=merge a duplicate of the seller's own listing is merged
+		// into it; otherwise duplicates are rejected.
+		if !isDraft {
+			duplicate, err := findDuplicateListing(userID, productName, *price, images)
 			if err != nil {
-				log.Printf("Error saving image record: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if duplicate != nil && duplicate.SameSeller && r.FormValue("onDuplicate") == "merge" {
+				recordMerge := trackListingChange(duplicate.ListingID, userID, RevisionEdit)
+				if err := mergeDuplicateListing(duplicate.ListingID, images); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				recordMerge()
+				duplicate.Merged = true
+				writeListing(w, http.StatusOK, duplicate.ListingID, func(l *Listing) {
+					l.Duplicate = duplicate
+				})
+				return
+			}
+			if duplicate != nil {
+				writeDuplicateConflict(w, duplicate)
+				return
 			}
 		}
 
-		// Fetch all listings for the user (with full image data)
-		rows, err := db.Query("SELECT id, user_id, product_name, product_description, price, category, created_at, updated_at FROM listings WHERE user_id = $1", userID)
+		now := time.Now()
+		status := StatusActive
+		expiresAt := sql.NullTime{Time: now.Add(listingExpiryDuration()), Valid: true}
+		if isDraft {
+			// Drafts start expiring once they are published.
+			status = StatusDraft
+			expiresAt = sql.NullTime{}
+		}
+
+		// The listing, its tags and its images are saved together so that a
+		// failure never leaves a listing without the images it was posted with.
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
+		defer tx.Rollback()
 
-		var listings []Listing
-		for rows.Next() {
-			var l Listing
-			if err := rows.Scan(&l.ID, &l.UserID, &l.ProductName, &l.ProductDescription, &l.Price, &l.Category, &l.CreatedAt, &l.UpdatedAt); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		var listingID int
+		err = tx.QueryRow(
+			"INSERT INTO listings(user_id, product_name, product_description, price, category, attributes, status, publish_at, created_at, updated_at, expires_at, pickup_location_id, pickup_lat, pickup_lon) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id",
+			userID, productName, productDescription, price, sql.NullString{String: category, Valid: category != ""}, attributes, status, publishAt, now, now, expiresAt, pickup.LocationID, pickup.Lat, pickup.Lon,
+		).Scan(&listingID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(tags) > 0 {
+			if err := replaceListingTags(tx, listingID, tags); err != nil {
+				http.Error(w, "Error saving tags: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
-			// Fetch image data.
-			imageRows, err := db.Query("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = $1", l.ID)
-			if err == nil {
-				var images []map[string]interface{}
-				for imageRows.Next() {
-					var imageID int
-					var imageData []byte
-					var contentType string
-					if err := imageRows.Scan(&imageID, &imageData, &contentType); err == nil {
-						encodedData := base64.StdEncoding.EncodeToString(imageData)
-						images = append(images, map[string]interface{}{
-							"id":          imageID,
-							"contentType": contentType,
-							"data":        encodedData,
-						})
-					}
-				}
-				l.Images = images
-				imageRows.Close()
+		}
+		for _, img := range images {
+			if _, err := tx.Exec(
+				"INSERT INTO listing_images(listing_id, image_data, content_type) VALUES($1, $2, $3)",
+				listingID, img.Data, img.ContentType,
+			); err != nil {
+				http.Error(w, "Error saving image: "+err.Error(), http.StatusInternalServerError)
+				return
 			}
-			listings = append(listings, l)
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(listings)
+		recordListingCreated(listingID, userID)
+		if screening.Verdict == ScreenFlag {
+			flagListingForReview(listingID, screening.Reasons)
+		}
+		if !isDraft {
+			go listingPublished(listingID)
+		}
+
+		writeListing(w, http.StatusCreated, listingID, func(l *Listing) {
+			l.Screening = &screening
+		})
 	}
 }
 
-// userListingsHandler handles GET requests to fetch listings for the current user.
+// writeListing responds with a single listing, with full image data, after
+// it is created or merged into. annotate is called on the listing first.
+func writeListing(w http.ResponseWriter, status, listingID int, annotate func(l *Listing)) {
+	l, err := getListing(listingID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l.Images = fetchListingImages(l.ID)
+	annotate(&l)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(l)
+}
+
+// userListingsHandler handles GET requests to fetch a page of listings for the current user.
+// Every status is included so that sold and archived items stay in the seller's history.
 func userListingsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get userId from header
 	userIDStr := r.Header.Get("userId")
@@ -247,14 +400,23 @@ func userListingsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid userId header", http.StatusBadRequest)
 		return
 	}
-	_, _, _, _, _, phone, address, err := GetUserInfo(userID)
+
+	limit, cursor, err := parsePageParams(r)
 	if err != nil {
-		http.Error(w, "Error getting user details", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	q := &listingQuery{}
+	q.where("l.user_id = $%d", userID)
+	q.where("l.deleted_at IS NULL")
+	if err := q.paginate(defaultListingSort, cursor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, args := q.build("SELECT "+listingColumns+listingFrom, limit+1)
 
-	rows, err := db.Query("SELECT id, user_id, product_name, product_description, price, category, created_at, updated_at FROM listings WHERE user_id = $1", userID)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -264,36 +426,16 @@ func userListingsHandler(w http.ResponseWriter, r *http.Request) {
 	var listings []Listing
 	for rows.Next() {
 		var l Listing
-		if err := rows.Scan(&l.ID, &l.UserID, &l.ProductName, &l.ProductDescription, &l.Price, &l.Category, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		if err := scanListing(rows, &l); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		l.UserAddress = address
-		l.UserPhone = phone
 		// Fetch image data.
-		imageRows, err := db.Query("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = $1", l.ID)
-		if err == nil {
-			var images []map[string]interface{}
-			for imageRows.Next() {
-				var imageID int
-				var imageData []byte
-				var contentType string
-				if err := imageRows.Scan(&imageID, &imageData, &contentType); err == nil {
-					encodedData := base64.StdEncoding.EncodeToString(imageData)
-					images = append(images, map[string]interface{}{
-						"id":          imageID,
-						"contentType": contentType,
-						"data":        encodedData,
-					})
-				}
-			}
-			l.Images = images
-			imageRows.Close()
-		}
+		l.Images = fetchListingImages(l.ID)
 		listings = append(listings, l)
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(listings)
+	json.NewEncoder(w).Encode(newListingsPage(listings, limit, defaultListingSort))
 }
 
 // editListingHandler handles PUT requests to edit a listing (only if owned by the current user).
@@ -329,34 +471,85 @@ func editListingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ownerID int
-	err = db.QueryRow("SELECT user_id FROM listings WHERE id = $1", listingID).Scan(&ownerID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Listing not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if ownerID != currentUserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	existing, ok := requireListingOwner(w, listingID, currentUserID)
+	if !ok {
 		return
 	}
+	recordEdit := trackListingChange(listingID, currentUserID, RevisionEdit)
 
 	// Update listing text fields.
 	productName := r.FormValue("productName")
 	productDescription := r.FormValue("productDescription")
 	priceStr := r.FormValue("price")
-	var price float64
+	var price Money
 	if priceStr != "" {
-		price, err = strconv.ParseFloat(priceStr, 64)
+		price, err = parseMoney(priceStr)
 		if err != nil {
-			http.Error(w, "Invalid price", http.StatusBadRequest)
+			http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
 	category := r.FormValue("category")
+	if category != "" {
+		category, err = resolveCategory(category)
+		if err != nil {
+			http.Error(w, "Invalid category: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Attributes are re-validated when they are sent or when the category
+	// changes, since the new category may require a different set.
+	var attributes []byte
+	attributesStr, attributesSent := r.MultipartForm.Value["attributes"]
+	if attributesSent || (category != "" && category != existing.Category) {
+		targetCategory := existing.Category
+		if category != "" {
+			targetCategory = category
+		}
+		if attributesSent {
+			attributes, err = resolveListingAttributes(targetCategory, attributesStr[0])
+		} else {
+			attributes, err = revalidateListingAttributes(targetCategory, existing.Attributes)
+		}
+		if err != nil {
+			http.Error(w, "Invalid attributes: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pickup, err := parsePickupForm(r.MultipartForm.Value)
+	if err != nil {
+		http.Error(w, "Invalid pickup location: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tags, tagsSent, err := parseTagsForm(r.MultipartForm.Value)
+	if err != nil {
+		http.Error(w, "Invalid tags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := r.MultipartForm.File["images"]
+	if len(files) > maxListingImages {
+		http.Error(w, fmt.Sprintf("A listing can have at most %d images", maxListingImages), http.StatusBadRequest)
+		return
+	}
+
+	// The edited text is screened as it will read after the update.
+	screening := ScreeningResult{Verdict: ScreenAllow, Reasons: []string{}}
+	if productName != "" || productDescription != "" {
+		content := listingContent{Name: existing.ProductName, Description: existing.ProductDescription}
+		if productName != "" {
+			content.Name = productName
+		}
+		if productDescription != "" {
+			content.Description = productDescription
+		}
+		screening = screenListingContent(content)
+		if screening.Verdict == ScreenReject {
+			http.Error(w, "Listing rejected: "+strings.Join(screening.Reasons, "; "), http.StatusUnprocessableEntity)
+			return
+		}
+	}
 
 	updateQuery := "UPDATE listings SET "
 	params := []interface{}{}
@@ -382,54 +575,104 @@ func editListingHandler(w http.ResponseWriter, r *http.Request) {
 		params = append(params, category)
 		paramIndex++
 	}
+	if attributes != nil {
+		updates = append(updates, fmt.Sprintf("attributes = $%d", paramIndex))
+		params = append(params, attributes)
+		paramIndex++
+	}
+	if pickup.Set {
+		updates = append(updates, fmt.Sprintf("pickup_location_id = $%d, pickup_lat = $%d, pickup_lon = $%d", paramIndex, paramIndex+1, paramIndex+2))
+		params = append(params, pickup.LocationID, pickup.Lat, pickup.Lon)
+		paramIndex += 3
+	}
+	now := time.Now()
 	updates = append(updates, fmt.Sprintf("updated_at = $%d", paramIndex))
-	params = append(params, time.Now())
+	params = append(params, now)
 	paramIndex++
 
+	// New images replace all existing ones.
+	var images []listingImage
+	for _, fileHeader := range files {
+		imageData, contentType, err := readImageData(fileHeader)
+		if err != nil {
+			log.Printf("Error reading image: %v", err)
+			continue
+		}
+		if len(imageData) > 5<<20 {
+			log.Printf("Image too large: %s", fileHeader.Filename)
+			continue
+		}
+		images = append(images, listingImage{Data: imageData, ContentType: contentType})
+	}
+
 	// Only run the update query if there are fields to update.
+	priceChanged := priceStr != "" && (!existing.PriceSet || price != existing.Price)
 	if len(updates) > 0 {
 		updateQuery += strings.Join(updates, ", ")
 		updateQuery += fmt.Sprintf(" WHERE id = $%d AND user_id = $%d", paramIndex, paramIndex+1)
 		params = append(params, listingID, currentUserID)
 
-		_, err = db.Exec(updateQuery, params...)
+		// A price change is written to the price history, and new tags and
+		// images are set, in the same transaction.
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-	}
-
-	// If new images are provided, delete all existing images and add the new ones.
-	files := r.MultipartForm.File["images"]
-	if len(files) > 0 {
-		_, err := db.Exec("DELETE FROM listing_images WHERE listing_id = $1", listingID)
-		if err != nil {
-			http.Error(w, "Error deleting existing images: "+err.Error(), http.StatusInternalServerError)
+		defer tx.Rollback()
+		if _, err := tx.Exec(updateQuery, params...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		for _, fileHeader := range files {
-			imageData, contentType, err := readImageData(fileHeader)
-			if err != nil {
-				log.Printf("Error reading image: %v", err)
-				continue
+		// A draft's first price is not a change.
+		if priceChanged && existing.PriceSet {
+			if err := insertPriceChange(tx, listingID, existing.Price, price, now); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
-			if len(imageData) > 5<<20 {
-				log.Printf("Image too large: %s", fileHeader.Filename)
-				continue
+		}
+		if tagsSent {
+			if err := replaceListingTags(tx, listingID, tags); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
-			_, err = db.Exec("INSERT INTO listing_images(listing_id, image_data, content_type) VALUES($1, $2, $3)", listingID, imageData, contentType)
-			if err != nil {
-				log.Printf("Error inserting new image: %v", err)
-				continue
+		}
+		if len(images) > 0 {
+			if _, err := tx.Exec("DELETE FROM listing_images WHERE listing_id = $1", listingID); err != nil {
+				http.Error(w, "Error deleting existing images: "+err.Error(), http.StatusInternalServerError)
+				return
 			}
+			for _, img := range images {
+				if _, err := tx.Exec(
+					"INSERT INTO listing_images(listing_id, image_data, content_type) VALUES($1, $2, $3)",
+					listingID, img.Data, img.ContentType,
+				); err != nil {
+					http.Error(w, "Error saving image: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
+	if priceChanged && existing.PriceSet && existing.Status == StatusActive && isAlertablePriceDrop(existing.Price, price) {
+		go notifyPriceDrop(listingID, existing.ProductName, existing.Price, price)
+	}
+
+	recordEdit()
+	if screening.Verdict == ScreenFlag {
+		flagListingForReview(listingID, screening.Reasons)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Listing updated successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Listing updated successfully", "screening": screening})
 }
 
-// deleteListingHandler handles DELETE requests to remove a listing (and all its images).
+// deleteListingHandler handles DELETE requests to remove a listing. The
+// listing is only soft-deleted: its owner can restore it within the restore
+// window, after which purgeDeletedListings removes it and its images.
 func deleteListingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -454,36 +697,52 @@ func deleteListingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ownerID int
-	err = db.QueryRow("SELECT user_id FROM listings WHERE id = $1", listingID).Scan(&ownerID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Listing not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if ownerID != currentUserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if _, ok := requireListingOwner(w, listingID, currentUserID); !ok {
 		return
 	}
+	recordDelete := trackListingChange(listingID, currentUserID, RevisionDelete)
 
-	_, err = db.Exec("DELETE FROM listing_images WHERE listing_id = $1", listingID)
+	deleted, err := softDeleteListing(listingID, currentUserID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	_, err = db.Exec("DELETE FROM listings WHERE id = $1 AND user_id = $2", listingID, currentUserID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !deleted {
+		http.Error(w, "Listing not found", http.StatusNotFound)
 		return
 	}
+	recordDelete()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Listing deleted successfully"})
 }
 
+// fetchListingImages loads the images for a listing as base64-encoded maps.
+// Read errors are ignored so that a listing is still returned without images.
+func fetchListingImages(listingID int) []map[string]interface{} {
+	imageRows, err := db.Query("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = $1", listingID)
+	if err != nil {
+		return nil
+	}
+	defer imageRows.Close()
+
+	var images []map[string]interface{}
+	for imageRows.Next() {
+		var imageID int
+		var imageData []byte
+		var contentType string
+		if err := imageRows.Scan(&imageID, &imageData, &contentType); err == nil {
+			encodedData := base64.StdEncoding.EncodeToString(imageData)
+			images = append(images, map[string]interface{}{
+				"id":          imageID,
+				"contentType": contentType,
+				"data":        encodedData,
+			})
+		}
+	}
+	return images
+}
+
 // readImageData reads the uploaded image into a byte slice.
 func readImageData(fileHeader *multipart.FileHeader) ([]byte, string, error) {
 	file, err := fileHeader.Open()
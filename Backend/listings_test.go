@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingsHandlerCreatesListingAtomically(t *testing.T) {
+	stubListingRevisions(t)
+	originalAttributes := getCategoryAttributes
+	originalGetListing := getListing
+	defer func() {
+		getCategoryAttributes = originalAttributes
+		getListing = originalGetListing
+	}()
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusDraft}, nil
+	}
+
+	newRequest := func(t *testing.T) *http.Request {
+		var b bytes.Buffer
+		wr := multipart.NewWriter(&b)
+		assert.NoError(t, wr.WriteField("draft", "true"))
+		assert.NoError(t, wr.WriteField("productName", "Oak desk"))
+		assert.NoError(t, wr.WriteField("tags", "oak"))
+		part, err := wr.CreateFormFile("images", "desk.png")
+		assert.NoError(t, err)
+		part.Write([]byte("\x89PNG\r\n\x1a\n"))
+		assert.NoError(t, wr.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/listings", &b)
+		req.Header.Set("Content-Type", wr.FormDataContentType())
+		req.Header.Set("userId", "1")
+		return req
+	}
+
+	tests := []struct {
+		name           string
+		imageErr       error
+		expectedStatus int
+	}{
+		{"Saved together", nil, http.StatusCreated},
+		{"Image failure rolls back", errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer mockDB.Close()
+			originalDB := db
+			db = mockDB
+			defer func() { db = originalDB }()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("INSERT INTO listings").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+			mock.ExpectExec("DELETE FROM listing_tags WHERE listing_id = \\$1").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO tags").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO listing_tags").WillReturnResult(sqlmock.NewResult(0, 1))
+			insertImage := mock.ExpectExec("INSERT INTO listing_images").WithArgs(9, sqlmock.AnyArg(), "image/png")
+			if tt.imageErr != nil {
+				insertImage.WillReturnError(tt.imageErr)
+				mock.ExpectRollback()
+			} else {
+				insertImage.WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+					WithArgs(9).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+			}
+
+			rr := httptest.NewRecorder()
+			listingsHandler(rr, newRequest(t))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListingsHandlerPublishesFreeListing(t *testing.T) {
+	stubListingRevisions(t)
+	stubDuplicateLookups(t, nil)
+	originalResolve := resolveCategory
+	originalAttributes := getCategoryAttributes
+	originalGetListing := getListing
+	defer func() {
+		resolveCategory = originalResolve
+		getCategoryAttributes = originalAttributes
+		getListing = originalGetListing
+	}()
+	resolveCategory = func(input string) (string, error) { return "furniture", nil }
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive, PriceSet: true}, nil
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO listings").
+		WithArgs(1, "Bookshelf", "", "0.00", "furniture", sqlmock.AnyArg(), StatusActive, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+
+	body, contentType := listingForm(t, map[string]string{"productName": "Bookshelf", "price": "0", "category": "Furniture"})
+	req := httptest.NewRequest(http.MethodPost, "/listings", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+
+	listingsHandler(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListingHandlersCapImages(t *testing.T) {
+	stubListingRevisions(t)
+	originalAttributes := getCategoryAttributes
+	originalGetListing := getListing
+	defer func() {
+		getCategoryAttributes = originalAttributes
+		getListing = originalGetListing
+	}()
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+
+	newRequest := func(t *testing.T, method, target string, fields map[string]string) *http.Request {
+		var b bytes.Buffer
+		wr := multipart.NewWriter(&b)
+		for k, v := range fields {
+			assert.NoError(t, wr.WriteField(k, v))
+		}
+		for i := 0; i <= maxListingImages; i++ {
+			part, err := wr.CreateFormFile("images", "desk.png")
+			assert.NoError(t, err)
+			part.Write([]byte("\x89PNG\r\n\x1a\n"))
+		}
+		assert.NoError(t, wr.Close())
+
+		req := httptest.NewRequest(method, target, &b)
+		req.Header.Set("Content-Type", wr.FormDataContentType())
+		req.Header.Set("userId", "1")
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	listingsHandler(rr, newRequest(t, http.MethodPost, "/listings", map[string]string{"draft": "true", "productName": "Oak desk"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "at most 10 images")
+
+	rr = httptest.NewRecorder()
+	editListingHandler(rr, newRequest(t, http.MethodPut, "/listing/updateListing", map[string]string{"listingId": "3"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "at most 10 images")
+}
+
+func TestEditListingHandlerReplacesImagesAtomically(t *testing.T) {
+	stubListingRevisions(t)
+	originalGetListing := getListing
+	defer func() { getListing = originalGetListing }()
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive, ProductName: "Desk"}, nil
+	}
+
+	newRequest := func(t *testing.T) *http.Request {
+		var b bytes.Buffer
+		wr := multipart.NewWriter(&b)
+		assert.NoError(t, wr.WriteField("listingId", "3"))
+		part, err := wr.CreateFormFile("images", "desk.png")
+		assert.NoError(t, err)
+		part.Write([]byte("\x89PNG\r\n\x1a\n"))
+		assert.NoError(t, wr.Close())
+
+		req := httptest.NewRequest(http.MethodPut, "/listing/updateListing", &b)
+		req.Header.Set("Content-Type", wr.FormDataContentType())
+		req.Header.Set("userId", "1")
+		return req
+	}
+
+	tests := []struct {
+		name           string
+		imageErr       error
+		expectedStatus int
+	}{
+		{"Saved together", nil, http.StatusOK},
+		{"Image failure rolls back", errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer mockDB.Close()
+			originalDB := db
+			db = mockDB
+			defer func() { db = originalDB }()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE listings SET updated_at = \\$1 WHERE id = \\$2 AND user_id = \\$3").
+				WithArgs(sqlmock.AnyArg(), 3, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("DELETE FROM listing_images WHERE listing_id = \\$1").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+			insertImage := mock.ExpectExec("INSERT INTO listing_images").WithArgs(3, sqlmock.AnyArg(), "image/png")
+			if tt.imageErr != nil {
+				insertImage.WillReturnError(tt.imageErr)
+				mock.ExpectRollback()
+			} else {
+				insertImage.WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			rr := httptest.NewRecorder()
+			editListingHandler(rr, newRequest(t))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
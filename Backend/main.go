@@ -2,13 +2,17 @@ package main
 
 import (
 	"UFMarketPlace/utils"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/rs/cors"
@@ -16,6 +20,9 @@ import (
 
 var db *sql.DB
 
+// shutdownTimeout is how long in-flight requests get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 type Config struct {
 	SMTP struct {
 		Host     string `json:"host"`
@@ -24,6 +31,19 @@ type Config struct {
 		Password string `json:"password"`
 		Sender   string `json:"sender"`
 	} `json:"smtp"`
+	Listings struct {
+		ExpiryDays            int     `json:"expiryDays"`
+		ReminderDays          int     `json:"reminderDays"`
+		SweepIntervalMinutes  int     `json:"sweepIntervalMinutes"`
+		RestoreDays           int     `json:"restoreDays"`
+		PriceDropAlertPercent float64 `json:"priceDropAlertPercent"`
+		OfferExpiryHours      int     `json:"offerExpiryHours"`
+		ReportHideThreshold   int     `json:"reportHideThreshold"`
+		DuplicateWindowDays   int     `json:"duplicateWindowDays"`
+	} `json:"listings"`
+	Screening struct {
+		Blocklist []BlocklistRuleConfig `json:"blocklist"`
+	} `json:"screening"`
 }
 
 var appConfig Config
@@ -71,14 +91,112 @@ func main() {
 		log.Fatalf("Failed to initialize listings database: %v", err)
 	}
 
+	// Initialize the category taxonomy and migrate existing listing categories.
+	if err := initCategoriesDB(); err != nil {
+		log.Fatalf("Failed to initialize categories: %v", err)
+	}
+
+	// Initialize per-category listing attributes.
+	if err := initCategoryAttributesDB(); err != nil {
+		log.Fatalf("Failed to initialize category attributes: %v", err)
+	}
+
+	// Add listing expiry, drafts, history, soft deletes, favorites, price
+	// history, saved searches, analytics, pickup locations, offers, tags and
+	// reports, make money columns exact, hash listing images, then start the
+	// background jobs.
+	if err := initListingExpiryDB(); err != nil {
+		log.Fatalf("Failed to initialize listing expiry: %v", err)
+	}
+	if err := initListingDraftsDB(); err != nil {
+		log.Fatalf("Failed to initialize listing drafts: %v", err)
+	}
+	if err := initListingRevisionsDB(); err != nil {
+		log.Fatalf("Failed to initialize listing revisions: %v", err)
+	}
+	if err := initListingDeletionDB(); err != nil {
+		log.Fatalf("Failed to initialize listing deletion: %v", err)
+	}
+	if err := initFavoritesDB(); err != nil {
+		log.Fatalf("Failed to initialize favorites: %v", err)
+	}
+	if err := initListingPriceHistoryDB(); err != nil {
+		log.Fatalf("Failed to initialize listing price history: %v", err)
+	}
+	if err := initSavedSearchesDB(); err != nil {
+		log.Fatalf("Failed to initialize saved searches: %v", err)
+	}
+	if err := initListingAnalyticsDB(); err != nil {
+		log.Fatalf("Failed to initialize listing analytics: %v", err)
+	}
+	if err := initPickupLocationsDB(); err != nil {
+		log.Fatalf("Failed to initialize pickup locations: %v", err)
+	}
+	if err := initOffersDB(); err != nil {
+		log.Fatalf("Failed to initialize offers: %v", err)
+	}
+	if err := initTagsDB(); err != nil {
+		log.Fatalf("Failed to initialize tags: %v", err)
+	}
+	if err := initReportsDB(); err != nil {
+		log.Fatalf("Failed to initialize reports: %v", err)
+	}
+	if err := initMoneyDB(); err != nil {
+		log.Fatalf("Failed to initialize money columns: %v", err)
+	}
+	if err := initDuplicatesDB(); err != nil {
+		log.Fatalf("Failed to initialize image hashes: %v", err)
+	}
+
+	// Build the content screening pipeline from the configured blocklist.
+	if err := initListingScreening(); err != nil {
+		log.Fatalf("Failed to initialize listing screening: %v", err)
+	}
+
+	jobs := append(listingExpiryJobs(),
+		scheduledJob{Name: "publish-scheduled-drafts", Interval: publishDraftsInterval, Run: publishScheduledDrafts},
+		listingPurgeJob(),
+		savedSearchDigestJob(),
+		listingEventsJob(),
+		offerExpiryJob(),
+	)
+	stopJobs := startScheduler(jobs)
+	defer stopJobs()
+
 	// Set up HTTP routes.
 	router := http.NewServeMux()
 	router.HandleFunc("/signup", signupHandler)
 	router.HandleFunc("/login", loginHandler)
 	router.Handle("/listings", SessionValidationMiddleware(http.HandlerFunc(listingsHandler)) )             // GET (all listings except current user) & POST (create new listing)
 	router.Handle("/listings/user", SessionValidationMiddleware(http.HandlerFunc(userListingsHandler) ) )     // GET (listings for current user)
+	router.Handle("/listings/user/export", SessionValidationMiddleware(http.HandlerFunc(exportListingsHandler))) // GET (download own listings as CSV or JSON)
+	router.Handle("/listings/user/analytics", SessionValidationMiddleware(http.HandlerFunc(sellerAnalyticsHandler))) // GET (views, favorites and inquiries per listing)
+	router.Handle("/listings/import", SessionValidationMiddleware(http.HandlerFunc(importListingsHandler)))      // POST (bulk import listings from CSV or JSON)
+	router.Handle("/listings/search", SessionValidationMiddleware(http.HandlerFunc(searchListingsHandler)))      // GET (full-text search over listings)
+	router.Handle("/listings/{id}", SessionValidationMiddleware(http.HandlerFunc(listingDetailHandler)))         // GET (single listing by id)
+	router.Handle("/listings/{id}/status", SessionValidationMiddleware(http.HandlerFunc(listingStatusHandler)))  // PUT (change listing status)
+	router.Handle("/listings/{id}/renew", SessionValidationMiddleware(http.HandlerFunc(renewListingHandler)))    // POST (extend listing expiry)
+	router.Handle("/listings/{id}/publish", SessionValidationMiddleware(http.HandlerFunc(publishListingHandler))) // POST (publish or schedule a draft)
+	router.Handle("/listings/{id}/restore", SessionValidationMiddleware(http.HandlerFunc(restoreListingHandler))) // POST (restore a deleted listing)
+	router.Handle("/listings/{id}/favorite", SessionValidationMiddleware(http.HandlerFunc(favoriteListingHandler))) // POST (favorite a listing) & DELETE (unfavorite)
+	router.Handle("/listings/{id}/inquiry", SessionValidationMiddleware(http.HandlerFunc(listingInquiryHandler))) // POST (count a buyer contacting the seller)
+	router.Handle("/listings/{id}/offers", SessionValidationMiddleware(http.HandlerFunc(listingOffersHandler)))   // POST (make an offer) & GET (offers on a listing)
+	router.Handle("/listings/{id}/report", SessionValidationMiddleware(http.HandlerFunc(reportListingHandler)))   // POST (report a listing to moderators)
+	router.Handle("/listings/{id}/similar", SessionValidationMiddleware(http.HandlerFunc(similarListingsHandler))) // GET (similar active listings)
+	router.Handle("/listings/{id}/history", SessionValidationMiddleware(http.HandlerFunc(listingHistoryHandler))) // GET (listing change history, owner or admin)
 	router.Handle("/listing/updateListing", SessionValidationMiddleware(http.HandlerFunc(editListingHandler)))   // PUT (edit listing)
 	router.Handle("/listing/deleteListing", SessionValidationMiddleware(http.HandlerFunc(deleteListingHandler))) // DELETE (delete listing)
+	router.Handle("/favorites", SessionValidationMiddleware(http.HandlerFunc(favoritesHandler)))                             // GET (listings the current user favorited)
+	router.Handle("/offers/{id}", SessionValidationMiddleware(http.HandlerFunc(offerHandler)))                               // PUT (accept, reject or counter an offer) & DELETE (withdraw it)
+	router.Handle("/moderation/reports", SessionValidationMiddleware(http.HandlerFunc(moderationReportsHandler)))          // GET (moderation queue, moderators only)
+	router.Handle("/moderation/reports/{id}", SessionValidationMiddleware(http.HandlerFunc(moderationReportHandler)))     // PUT (triage or resolve a report, moderators only)
+	router.Handle("/saved-searches", SessionValidationMiddleware(http.HandlerFunc(savedSearchesHandler)))                  // GET (list saved searches) & POST (create saved search)
+	router.Handle("/saved-searches/settings", SessionValidationMiddleware(http.HandlerFunc(savedSearchSettingsHandler))) // GET & PUT (saved search notification frequency)
+	router.Handle("/saved-searches/{id}", SessionValidationMiddleware(http.HandlerFunc(savedSearchHandler)))             // PUT (update saved search) & DELETE (delete saved search)
+	router.HandleFunc("/categories", categoriesHandler)                                                                // GET (category tree)
+	router.HandleFunc("/categories/{slug}/attributes", categoryAttributesHandler)                                      // GET (attribute schema for a category)
+	router.HandleFunc("/pickup-locations", pickupLocationsHandler)                                                     // GET (campus pickup spots)
+	router.HandleFunc("/tags/popular", popularTagsHandler)                                                             // GET (most used tags, for autocomplete)
 	router.HandleFunc("/sendEmailVerificationCode", sendVerificationCodeHandler)
 	router.HandleFunc("/verifyEmailVerificationCode", verifyCodeHandler)
 	router.HandleFunc("/resetPassword", resetForgetPasswordHandler)
@@ -92,8 +210,25 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	// Serve until interrupted, then let in-flight requests finish before the
+	// deferred stopJobs gives the background jobs their final run.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 	log.Printf("Server running on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
 }
 
 func loadConfig(path string) {
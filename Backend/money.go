@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in US cents. It is stored in NUMERIC(12,2) columns and
+// written to JSON as a plain number of dollars, e.g. 19.99.
+type Money int64
+
+// maxMoney is the largest price or offer accepted, $1,000,000.
+const maxMoney Money = 100_000_000
+
+// moneyPattern accepts a non-negative decimal with at most two fraction
+// digits. Signs, exponents, NaN and Inf never match.
+var moneyPattern = regexp.MustCompile(`^[0-9]{1,12}(\.[0-9]{1,2})?$`)
+
+// parseMoney parses a dollar amount such as "19.99" or "20".
+func parseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !moneyPattern.MatchString(s) {
+		return 0, fmt.Errorf("must be a non-negative amount with at most 2 decimal places")
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	dollars, _ := strconv.ParseInt(whole, 10, 64)
+	cents, _ := strconv.ParseInt((frac + "00")[:2], 10, 64)
+	m := Money(dollars*100 + cents)
+	if m > maxMoney {
+		return 0, fmt.Errorf("must not exceed %s", maxMoney)
+	}
+	return m, nil
+}
+
+// String formats m with two decimals, e.g. "20.00".
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// Float64 returns m in dollars, for display and ratios only.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// MarshalJSON writes m as a JSON number without trailing zeros, which is
+// how the float64 prices it replaced were written.
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := strings.TrimRight(strings.TrimRight(m.String(), "0"), ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON reads a JSON number or numeric string and validates it like
+// parseMoney.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	v, err := parseMoney(s)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %v", data, err)
+	}
+	*m = v
+	return nil
+}
+
+// Value stores m as an exact decimal string.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// decimalPattern matches NUMERIC values as PostgreSQL writes them.
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]*)?$`)
+
+// Scan reads a NUMERIC column from its decimal text, without going through
+// float64. Rows written before prices were validated may have more than two
+// decimals; they are rounded to the nearest cent, halves away from zero.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		if !decimalPattern.MatchString(v) {
+			return fmt.Errorf("cannot scan %q into Money", v)
+		}
+		digits, negative := strings.CutPrefix(v, "-")
+		whole, frac, _ := strings.Cut(digits, ".")
+		frac += "000"
+		dollars, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || dollars > math.MaxInt64/100-1 {
+			return fmt.Errorf("cannot scan %q into Money", v)
+		}
+		cents, _ := strconv.ParseInt(frac[:2], 10, 64)
+		cents += dollars * 100
+		if frac[2] >= '5' {
+			cents++
+		}
+		if negative {
+			cents = -cents
+		}
+		*m = Money(cents)
+	case float64:
+		return m.Scan(strconv.FormatFloat(v, 'f', -1, 64))
+	case int64:
+		*m = Money(v * 100)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+// initMoneyDB makes the money columns exact to the cent. Older databases
+// created them as plain NUMERIC; existing values are rounded, and negative
+// prices are refused from now on without rejecting rows already stored.
+func initMoneyDB() error {
+	moneySchema := `
+	DO $$
+	DECLARE
+		col RECORD;
+	BEGIN
+		FOR col IN
+			SELECT table_name, column_name FROM information_schema.columns
+			WHERE table_schema = current_schema()
+			AND (table_name, column_name) IN (('listings', 'price'), ('listing_price_history', 'old_price'),
+				('listing_price_history', 'new_price'), ('offers', 'amount'))
+			AND (numeric_precision IS DISTINCT FROM 12 OR numeric_scale IS DISTINCT FROM 2)
+		LOOP
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE NUMERIC(12,2)', col.table_name, col.column_name);
+		END LOOP;
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'listings_price_check') THEN
+			ALTER TABLE listings ADD CONSTRAINT listings_price_check CHECK (price >= 0) NOT VALID;
+		END IF;
+	END $$;`
+	if _, err := db.Exec(moneySchema); err != nil {
+		return fmt.Errorf("error converting money columns: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := map[string]Money{
+		"0":          0,
+		"20":         2000,
+		"19.9":       1990,
+		"19.99":      1999,
+		" 5.05 ":     505,
+		"1000000.00": maxMoney,
+	}
+	for input, want := range valid {
+		got, err := parseMoney(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "19.999", "-1", "+1", "1e3", "NaN", "Inf", "1,000", "19.", ".5", "1000000.01"} {
+		_, err := parseMoney(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	// Money is written the same way as the float64 prices it replaced.
+	for _, m := range []Money{0, 5, 1990, 1999, 2000, 123456} {
+		got, err := json.Marshal(m)
+		assert.NoError(t, err)
+		want, _ := json.Marshal(m.Float64())
+		assert.Equal(t, string(want), string(got))
+	}
+
+	var body struct {
+		Price Money `json:"price"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"price": 19.99}`), &body))
+	assert.Equal(t, Money(1999), body.Price)
+	assert.NoError(t, json.Unmarshal([]byte(`{"price": "7.5"}`), &body))
+	assert.Equal(t, Money(750), body.Price)
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 19.999}`), &body))
+	assert.Error(t, json.Unmarshal([]byte(`{"price": -2}`), &body))
+}
+
+func TestMoneySQL(t *testing.T) {
+	value, err := Money(1990).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "19.90", value)
+
+	var m Money
+	assert.NoError(t, m.Scan([]byte("19.99")))
+	assert.Equal(t, Money(1999), m)
+	// Rows stored before validation are rounded to the cent.
+	assert.NoError(t, m.Scan("19.999"))
+	assert.Equal(t, Money(2000), m)
+	// 19.995 is not exact as a float64 and would round down.
+	assert.NoError(t, m.Scan("19.995"))
+	assert.Equal(t, Money(2000), m)
+	assert.NoError(t, m.Scan("19.994"))
+	assert.Equal(t, Money(1999), m)
+	assert.NoError(t, m.Scan("-2.50"))
+	assert.Equal(t, Money(-250), m)
+	assert.NoError(t, m.Scan("90071992547409.93"))
+	assert.Equal(t, Money(9007199254740993), m)
+	assert.NoError(t, m.Scan(12.5))
+	assert.Equal(t, Money(1250), m)
+	assert.Error(t, m.Scan("1e3"))
+	assert.Error(t, m.Scan("NaN"))
+	assert.NoError(t, m.Scan(int64(3)))
+	assert.Equal(t, Money(300), m)
+	assert.Error(t, m.Scan(nil))
+}
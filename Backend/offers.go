@@ -0,0 +1,483 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Offer statuses. Only pending offers can be answered; every other status
+// is final.
+const (
+	OfferPending   = "pending"
+	OfferAccepted  = "accepted"
+	OfferRejected  = "rejected"
+	OfferCountered = "countered"
+	OfferWithdrawn = "withdrawn"
+	OfferExpired   = "expired"
+)
+
+// Responses to a pending offer.
+const (
+	OfferActionAccept  = "accept"
+	OfferActionReject  = "reject"
+	OfferActionCounter = "counter"
+)
+
+const defaultOfferExpiryHours = 48
+
+// offerExpiryDuration is how long an offer or counter-offer stays open.
+func offerExpiryDuration() time.Duration {
+	hours := appConfig.Listings.OfferExpiryHours
+	if hours <= 0 {
+		hours = defaultOfferExpiryHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// initOffersDB creates the offers table. A counter-offer is a new row whose
+// parent is the offer it answers, so a negotiation is a chain of offers
+// between one buyer and the seller. A buyer has at most one pending offer
+// per listing.
+func initOffersDB() error {
+	offersSchema := `
+	CREATE TABLE IF NOT EXISTS offers (
+		id SERIAL PRIMARY KEY,
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		buyer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES offers(id) ON DELETE SET NULL,
+		amount NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+		status TEXT NOT NULL DEFAULT 'pending',
+		expires_at TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		responded_at TIMESTAMPTZ
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_pending_buyer ON offers (listing_id, buyer_id) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS idx_offers_pending_expires_at ON offers (expires_at) WHERE status = 'pending';`
+	if _, err := db.Exec(offersSchema); err != nil {
+		return fmt.Errorf("error creating offers table: %v", err)
+	}
+	return nil
+}
+
+// Offer is one step of a negotiation. FromUserID is the buyer for the
+// opening offer and alternates with each counter-offer.
+type Offer struct {
+	ID          int        `json:"id"`
+	ListingID   int        `json:"listingId"`
+	BuyerID     int        `json:"buyerId"`
+	SellerID    int        `json:"sellerId"`
+	FromUserID  int        `json:"fromUserId"`
+	ParentID    *int       `json:"parentId"`
+	Amount      Money      `json:"amount"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt"`
+}
+
+// recipientID returns the user who may answer the offer.
+func (o Offer) recipientID() int {
+	if o.FromUserID == o.BuyerID {
+		return o.SellerID
+	}
+	return o.BuyerID
+}
+
+// Errors returned by the offer functions. All of them are client errors.
+var (
+	errOfferExists         = errors.New("you already have a pending offer on this listing")
+	errOfferClosed         = errors.New("offer is no longer pending")
+	errOfferNotRecipient   = errors.New("only the other party can answer this offer")
+	errListingNotAvailable = errors.New("listing is not open for offers")
+)
+
+// offerColumns is the select list read by scanOffer. Queries using it must
+// alias offers as o and join listings as l.
+const offerColumns = "o.id, o.listing_id, o.buyer_id, l.user_id, o.from_user_id, o.parent_id, o.amount, o.status, o.expires_at, o.created_at, o.responded_at"
+
+func scanOffer(row rowScanner, o *Offer) error {
+	var parentID sql.NullInt64
+	var respondedAt sql.NullTime
+	if err := row.Scan(&o.ID, &o.ListingID, &o.BuyerID, &o.SellerID, &o.FromUserID, &parentID, &o.Amount, &o.Status, &o.ExpiresAt, &o.CreatedAt, &respondedAt); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		o.ParentID = &id
+	}
+	if respondedAt.Valid {
+		o.RespondedAt = &respondedAt.Time
+	}
+	return nil
+}
+
+// lockListingForOffers locks the listing row and returns its owner and
+// status. Every change to a listing's offers takes this lock first, so
+// concurrent responses on one listing run one after another and cannot
+// deadlock on each other's offer rows.
+func lockListingForOffers(tx *sql.Tx, listingID int) (int, string, error) {
+	var ownerID int
+	var status string
+	err := tx.QueryRow(
+		"SELECT user_id, status FROM listings WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", listingID,
+	).Scan(&ownerID, &status)
+	return ownerID, status, err
+}
+
+// insertOffer adds a pending offer and returns it.
+func insertOffer(tx *sql.Tx, o Offer) (Offer, error) {
+	var parentID sql.NullInt64
+	if o.ParentID != nil {
+		parentID = sql.NullInt64{Int64: int64(*o.ParentID), Valid: true}
+	}
+	o.Status = OfferPending
+	o.CreatedAt = time.Now()
+	o.ExpiresAt = o.CreatedAt.Add(offerExpiryDuration())
+	err := tx.QueryRow(
+		`INSERT INTO offers(listing_id, buyer_id, from_user_id, parent_id, amount, status, expires_at, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (listing_id, buyer_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id`,
+		o.ListingID, o.BuyerID, o.FromUserID, parentID, o.Amount, o.Status, o.ExpiresAt, o.CreatedAt,
+	).Scan(&o.ID)
+	if err == sql.ErrNoRows {
+		return o, errOfferExists
+	}
+	return o, err
+}
+
+// createOffer opens a negotiation on an active listing.
+var createOffer = func(listingID, buyerID int, amount Money) (Offer, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Offer{}, err
+	}
+	defer tx.Rollback()
+
+	sellerID, status, err := lockListingForOffers(tx, listingID)
+	if err == sql.ErrNoRows || (err == nil && (status != StatusActive || sellerID == buyerID)) {
+		return Offer{}, errListingNotAvailable
+	}
+	if err != nil {
+		return Offer{}, err
+	}
+	o, err := insertOffer(tx, Offer{ListingID: listingID, BuyerID: buyerID, SellerID: sellerID, FromUserID: buyerID, Amount: amount})
+	if err != nil {
+		return Offer{}, err
+	}
+	return o, tx.Commit()
+}
+
+// getOffer returns an offer by id.
+var getOffer = func(offerID int) (Offer, error) {
+	var o Offer
+	err := scanOffer(db.QueryRow("SELECT "+offerColumns+" FROM offers o JOIN listings l ON l.id = o.listing_id WHERE o.id = $1", offerID), &o)
+	return o, err
+}
+
+// respondToOffer accepts, rejects or counters a pending offer on behalf of
+// userID in one transaction. Accepting reserves the listing and rejects
+// every other pending offer on it. For a counter it returns the new offer,
+// otherwise the answered one.
+var respondToOffer = func(offerID, userID int, action string, counterAmount Money) (Offer, error) {
+	var listingID int
+	if err := db.QueryRow("SELECT listing_id FROM offers WHERE id = $1", offerID).Scan(&listingID); err != nil {
+		return Offer{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Offer{}, err
+	}
+	defer tx.Rollback()
+
+	_, listingStatus, err := lockListingForOffers(tx, listingID)
+	if err == sql.ErrNoRows {
+		return Offer{}, errListingNotAvailable
+	}
+	if err != nil {
+		return Offer{}, err
+	}
+	var o Offer
+	if err := scanOffer(tx.QueryRow(
+		"SELECT "+offerColumns+" FROM offers o JOIN listings l ON l.id = o.listing_id WHERE o.id = $1 FOR UPDATE OF o", offerID,
+	), &o); err != nil {
+		return Offer{}, err
+	}
+	if o.recipientID() != userID {
+		return Offer{}, errOfferNotRecipient
+	}
+	now := time.Now()
+	if o.Status != OfferPending || !o.ExpiresAt.After(now) {
+		return Offer{}, errOfferClosed
+	}
+	if action != OfferActionReject && listingStatus != StatusActive {
+		return Offer{}, errListingNotAvailable
+	}
+
+	newStatus := map[string]string{
+		OfferActionAccept:  OfferAccepted,
+		OfferActionReject:  OfferRejected,
+		OfferActionCounter: OfferCountered,
+	}[action]
+	if _, err := tx.Exec("UPDATE offers SET status = $1, responded_at = $2 WHERE id = $3", newStatus, now, offerID); err != nil {
+		return Offer{}, err
+	}
+	o.Status = newStatus
+	o.RespondedAt = &now
+
+	switch action {
+	case OfferActionAccept:
+		if _, err := tx.Exec(
+			"UPDATE listings SET status = $1, updated_at = $2 WHERE id = $3", StatusReserved, now, listingID,
+		); err != nil {
+			return Offer{}, err
+		}
+		if _, err := tx.Exec(
+			"UPDATE offers SET status = $1, responded_at = $2 WHERE listing_id = $3 AND status = $4",
+			OfferRejected, now, listingID, OfferPending,
+		); err != nil {
+			return Offer{}, err
+		}
+	case OfferActionCounter:
+		parentID := o.ID
+		o, err = insertOffer(tx, Offer{
+			ListingID: o.ListingID, BuyerID: o.BuyerID, SellerID: o.SellerID,
+			FromUserID: userID, ParentID: &parentID, Amount: counterAmount,
+		})
+		if err != nil {
+			return Offer{}, err
+		}
+	}
+	return o, tx.Commit()
+}
+
+// withdrawOffer withdraws a pending offer made by userID. It returns false
+// when there is no such offer.
+var withdrawOffer = func(offerID, userID int) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE offers SET status = $1, responded_at = $2 WHERE id = $3 AND from_user_id = $4 AND status = $5",
+		OfferWithdrawn, time.Now(), offerID, userID, OfferPending,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// getListingOffers returns the offers on a listing, newest first. A
+// non-zero buyerID limits them to that buyer's negotiation.
+var getListingOffers = func(listingID, buyerID int) ([]Offer, error) {
+	rows, err := db.Query(
+		"SELECT "+offerColumns+" FROM offers o JOIN listings l ON l.id = o.listing_id WHERE o.listing_id = $1 AND ($2 = 0 OR o.buyer_id = $2) ORDER BY o.created_at DESC, o.id DESC",
+		listingID, buyerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []Offer{}
+	for rows.Next() {
+		var o Offer
+		if err := scanOffer(rows, &o); err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	return offers, rows.Err()
+}
+
+// offerExpiryJob returns the background job that closes expired offers.
+// Responses check the expiry themselves, so the job only keeps the stored
+// status accurate.
+func offerExpiryJob() scheduledJob {
+	return scheduledJob{Name: "expire-offers", Interval: listingSweepInterval(), Run: expireOffers}
+}
+
+func expireOffers() error {
+	res, err := db.Exec(
+		"UPDATE offers SET status = $1 WHERE status = $2 AND expires_at <= $3",
+		OfferExpired, OfferPending, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Expired %d offers", n)
+	}
+	return nil
+}
+
+// offerError writes the response for an error from the offer functions.
+func offerError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "Offer not found", http.StatusNotFound)
+	case errors.Is(err, errOfferNotRecipient):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, errOfferExists), errors.Is(err, errOfferClosed), errors.Is(err, errListingNotAvailable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type offerRequest struct {
+	Action string `json:"action"`
+	Amount Money  `json:"amount"`
+}
+
+// listingOffersHandler handles POST /listings/{id}/offers, where a buyer
+// makes an offer, and GET, which returns every offer to the seller and
+// only their own negotiation to anyone else.
+func listingOffersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req offerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.Amount <= 0 {
+			http.Error(w, "Amount must be positive", http.StatusBadRequest)
+			return
+		}
+		o, err := createOffer(listingID, currentUserID, req.Amount)
+		if err != nil {
+			offerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(o)
+		return
+	}
+
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buyerID := currentUserID
+	if l.UserID == currentUserID {
+		buyerID = 0
+	}
+	offers, err := getListingOffers(listingID, buyerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"offers": offers,
+	})
+}
+
+// offerHandler handles PUT /offers/{id}, where the other party accepts,
+// rejects or counters an offer, and DELETE, where its maker withdraws it.
+func offerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	offerID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid offer id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		withdrawn, err := withdrawOffer(offerID, currentUserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !withdrawn {
+			http.Error(w, "No pending offer of yours with this id", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Offer withdrawn"})
+		return
+	}
+
+	var req offerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch req.Action {
+	case OfferActionAccept, OfferActionReject:
+	case OfferActionCounter:
+		if req.Amount <= 0 {
+			http.Error(w, "Amount must be positive", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Action must be accept, reject or counter", http.StatusBadRequest)
+		return
+	}
+
+	o, err := getOffer(offerID)
+	if err != nil {
+		offerError(w, err)
+		return
+	}
+	if o.recipientID() != currentUserID {
+		offerError(w, errOfferNotRecipient)
+		return
+	}
+
+	// Accepting reserves the listing, which is recorded in its history.
+	recordStatus := func() {}
+	if req.Action == OfferActionAccept {
+		recordStatus = trackListingChange(o.ListingID, currentUserID, RevisionStatus)
+	}
+	o, err = respondToOffer(offerID, currentUserID, req.Action, req.Amount)
+	if err != nil {
+		offerError(w, err)
+		return
+	}
+	recordStatus()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o)
+}
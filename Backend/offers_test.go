@@ -0,0 +1,250 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfferRecipientID(t *testing.T) {
+	offer := Offer{BuyerID: 2, SellerID: 1, FromUserID: 2}
+	assert.Equal(t, 1, offer.recipientID())
+
+	counter := Offer{BuyerID: 2, SellerID: 1, FromUserID: 1}
+	assert.Equal(t, 2, counter.recipientID())
+}
+
+func offerRows(o Offer) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "user_id", "from_user_id", "parent_id", "amount", "status", "expires_at", "created_at", "responded_at"}).
+		AddRow(o.ID, o.ListingID, o.BuyerID, o.SellerID, o.FromUserID, nil, o.Amount.String(), o.Status, o.ExpiresAt, o.CreatedAt, nil)
+}
+
+func TestRespondToOfferAccept(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	now := time.Now()
+	offer := Offer{ID: 7, ListingID: 3, BuyerID: 2, SellerID: 1, FromUserID: 2, Amount: 4000, Status: OfferPending, ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+
+	mock.ExpectQuery("SELECT listing_id FROM offers WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"listing_id"}).AddRow(3))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT user_id, status FROM listings WHERE id = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(1, StatusActive))
+	mock.ExpectQuery("SELECT .* FROM offers o JOIN listings l ON l.id = o.listing_id WHERE o.id = \\$1 FOR UPDATE OF o").
+		WithArgs(7).
+		WillReturnRows(offerRows(offer))
+	mock.ExpectExec("UPDATE offers SET status = \\$1, responded_at = \\$2 WHERE id = \\$3").
+		WithArgs(OfferAccepted, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE listings SET status = \\$1, updated_at = \\$2 WHERE id = \\$3").
+		WithArgs(StatusReserved, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE offers SET status = \\$1, responded_at = \\$2 WHERE listing_id = \\$3 AND status = \\$4").
+		WithArgs(OfferRejected, sqlmock.AnyArg(), 3, OfferPending).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	o, err := respondToOffer(7, 1, OfferActionAccept, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, OfferAccepted, o.Status)
+	assert.NotNil(t, o.RespondedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRespondToOfferRejectsClosedOffers(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		offer         Offer
+		listingStatus string
+		userID        int
+		action        string
+		want          error
+	}{
+		{"Already accepted", Offer{Status: OfferAccepted, ExpiresAt: now.Add(time.Hour)}, StatusReserved, 1, OfferActionAccept, errOfferClosed},
+		{"Expired", Offer{Status: OfferPending, ExpiresAt: now.Add(-time.Minute)}, StatusActive, 1, OfferActionAccept, errOfferClosed},
+		{"Listing reserved", Offer{Status: OfferPending, ExpiresAt: now.Add(time.Hour)}, StatusReserved, 1, OfferActionCounter, errListingNotAvailable},
+		{"Not the recipient", Offer{Status: OfferPending, ExpiresAt: now.Add(time.Hour)}, StatusActive, 2, OfferActionAccept, errOfferNotRecipient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer mockDB.Close()
+			originalDB := db
+			db = mockDB
+			defer func() { db = originalDB }()
+
+			offer := tt.offer
+			offer.ID, offer.ListingID, offer.BuyerID, offer.SellerID, offer.FromUserID = 7, 3, 2, 1, 2
+			mock.ExpectQuery("SELECT listing_id FROM offers").
+				WillReturnRows(sqlmock.NewRows([]string{"listing_id"}).AddRow(3))
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT user_id, status FROM listings").
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(1, tt.listingStatus))
+			mock.ExpectQuery("SELECT .* FROM offers o").
+				WillReturnRows(offerRows(offer))
+			mock.ExpectRollback()
+
+			_, err = respondToOffer(7, tt.userID, tt.action, 30)
+			assert.ErrorIs(t, err, tt.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListingOffersHandlerCreate(t *testing.T) {
+	originalCreate := createOffer
+	defer func() { createOffer = originalCreate }()
+
+	var gotAmount Money
+	createOffer = func(listingID, buyerID int, amount Money) (Offer, error) {
+		gotAmount = amount
+		if listingID == 9 {
+			return Offer{}, errListingNotAvailable
+		}
+		return Offer{ID: 1, ListingID: listingID, BuyerID: buyerID, FromUserID: buyerID, Amount: amount, Status: OfferPending}, nil
+	}
+
+	tests := []struct {
+		name           string
+		listingID      string
+		body           string
+		expectedStatus int
+	}{
+		{"Make offer", "3", `{"amount":35.5}`, http.StatusCreated},
+		{"Zero amount", "3", `{"amount":0}`, http.StatusBadRequest},
+		{"Bad payload", "3", `{"amount":"lots"}`, http.StatusBadRequest},
+		{"Listing not open", "9", `{"amount":10}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/listings/"+tt.listingID+"/offers", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", "2")
+			rr := httptest.NewRecorder()
+
+			listingOffersHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+	assert.Equal(t, Money(1000), gotAmount)
+}
+
+func TestListingOffersHandlerList(t *testing.T) {
+	originalGetListing := getListing
+	originalGetOffers := getListingOffers
+	defer func() {
+		getListing = originalGetListing
+		getListingOffers = originalGetOffers
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+	var gotBuyerID int
+	getListingOffers = func(listingID, buyerID int) ([]Offer, error) {
+		gotBuyerID = buyerID
+		return []Offer{}, nil
+	}
+
+	for userID, wantBuyerID := range map[string]int{"1": 0, "2": 2} {
+		req := httptest.NewRequest(http.MethodGet, "/listings/3/offers", nil)
+		req.SetPathValue("id", "3")
+		req.Header.Set("userId", userID)
+		rr := httptest.NewRecorder()
+
+		listingOffersHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, wantBuyerID, gotBuyerID, "user %s", userID)
+	}
+}
+
+func TestOfferHandler(t *testing.T) {
+	stubListingRevisions(t)
+	originalGet := getOffer
+	originalRespond := respondToOffer
+	originalWithdraw := withdrawOffer
+	defer func() {
+		getOffer = originalGet
+		respondToOffer = originalRespond
+		withdrawOffer = originalWithdraw
+	}()
+
+	getOffer = func(offerID int) (Offer, error) {
+		if offerID == 404 {
+			return Offer{}, sql.ErrNoRows
+		}
+		return Offer{ID: offerID, ListingID: 3, BuyerID: 2, SellerID: 1, FromUserID: 2, Status: OfferPending}, nil
+	}
+	respondToOffer = func(offerID, userID int, action string, counterAmount Money) (Offer, error) {
+		if offerID == 8 {
+			return Offer{}, errOfferClosed
+		}
+		if action == OfferActionCounter {
+			parentID := offerID
+			return Offer{ID: 100, ParentID: &parentID, FromUserID: userID, Amount: counterAmount, Status: OfferPending}, nil
+		}
+		return Offer{ID: offerID, Status: OfferAccepted}, nil
+	}
+	withdrawOffer = func(offerID, userID int) (bool, error) {
+		return offerID == 7 && userID == 2, nil
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		offerID        string
+		userID         string
+		body           string
+		expectedStatus int
+	}{
+		{"Seller accepts", http.MethodPut, "7", "1", `{"action":"accept"}`, http.StatusOK},
+		{"Seller counters", http.MethodPut, "7", "1", `{"action":"counter","amount":45}`, http.StatusOK},
+		{"Counter without amount", http.MethodPut, "7", "1", `{"action":"counter"}`, http.StatusBadRequest},
+		{"Counter with fractional cents", http.MethodPut, "7", "1", `{"action":"counter","amount":45.005}`, http.StatusBadRequest},
+		{"Unknown action", http.MethodPut, "7", "1", `{"action":"ignore"}`, http.StatusBadRequest},
+		{"Buyer answers own offer", http.MethodPut, "7", "2", `{"action":"accept"}`, http.StatusUnauthorized},
+		{"Offer already answered", http.MethodPut, "8", "1", `{"action":"reject"}`, http.StatusConflict},
+		{"Offer not found", http.MethodPut, "404", "1", `{"action":"reject"}`, http.StatusNotFound},
+		{"Buyer withdraws", http.MethodDelete, "7", "2", "", http.StatusOK},
+		{"Seller cannot withdraw", http.MethodDelete, "7", "1", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/offers/"+tt.offerID, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.offerID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			offerHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.name == "Seller counters" {
+				var o Offer
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &o))
+				assert.Equal(t, Money(4500), o.Amount)
+				assert.Equal(t, 7, *o.ParentID)
+			}
+		})
+	}
+}
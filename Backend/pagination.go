@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// ListingsPage is the response envelope for paginated listing feeds.
+type ListingsPage struct {
+	Listings   []Listing `json:"listings"`
+	NextCursor string    `json:"nextCursor"`
+}
+
+// listingCursor marks the position of the last listing returned in a page.
+// Listings are ordered by the sort key and then id, so the next page starts
+// strictly after the (key, id) pair. Sort is recorded so a cursor cannot be
+// replayed against a different ordering.
+type listingCursor struct {
+	Sort      string
+	CreatedAt time.Time
+	Price     Money
+	Distance  float64
+	Rank      float64
+	ID        int
+}
+
+// cursorAfter returns the cursor pointing just past the given listing.
+func cursorAfter(l Listing, sort string) listingCursor {
+	c := listingCursor{Sort: sort, CreatedAt: l.CreatedAt, Price: l.Price, ID: l.ID}
+	if l.DistanceKm != nil {
+		c.Distance = *l.DistanceKm
+	}
+	return c
+}
+
+// encodeCursor turns a cursor into an opaque URL-safe token.
+func encodeCursor(c listingCursor) string {
+	raw := fmt.Sprintf("%s|%s|%s|%d|%s|%s", c.Sort, c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		c.Price, c.ID, strconv.FormatFloat(c.Distance, 'f', -1, 64), strconv.FormatFloat(c.Rank, 'f', -1, 64))
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a token produced by encodeCursor.
+func decodeCursor(token string) (listingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listingCursor{}, fmt.Errorf("invalid cursor")
+	}
+	// Cursors issued before distance sorting existed have four parts, and
+	// those issued before relevance sorting five.
+	parts := strings.Split(string(raw), "|")
+	if len(parts) < 4 || len(parts) > 6 {
+		return listingCursor{}, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return listingCursor{}, fmt.Errorf("invalid cursor")
+	}
+	price, err := parseMoney(parts[2])
+	if err != nil {
+		return listingCursor{}, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return listingCursor{}, fmt.Errorf("invalid cursor")
+	}
+	var distance, rank float64
+	if len(parts) >= 5 {
+		if distance, err = strconv.ParseFloat(parts[4], 64); err != nil {
+			return listingCursor{}, fmt.Errorf("invalid cursor")
+		}
+	}
+	if len(parts) == 6 {
+		if rank, err = strconv.ParseFloat(parts[5], 64); err != nil {
+			return listingCursor{}, fmt.Errorf("invalid cursor")
+		}
+	}
+	return listingCursor{Sort: parts[0], CreatedAt: createdAt, Price: price, Distance: distance, Rank: rank, ID: id}, nil
+}
+
+// parsePageParams reads the limit and cursor query parameters.
+// A nil cursor means the first page was requested.
+func parsePageParams(r *http.Request) (int, *listingCursor, error) {
+	limit := defaultPageLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			return 0, nil, fmt.Errorf("invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		limit = n
+	}
+
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return limit, nil, nil
+	}
+	cursor, err := decodeCursor(token)
+	if err != nil {
+		return 0, nil, err
+	}
+	return limit, &cursor, nil
+}
+
+// newListingsPage trims a result set fetched with limit+1 rows down to limit
+// and sets NextCursor when more rows remain.
+func newListingsPage(listings []Listing, limit int, sort string) ListingsPage {
+	page := ListingsPage{Listings: listings}
+	if page.Listings == nil {
+		page.Listings = []Listing{}
+	}
+	if len(listings) > limit {
+		page.Listings = listings[:limit]
+		page.NextCursor = encodeCursor(cursorAfter(page.Listings[limit-1], sort))
+	}
+	return page
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := listingCursor{Sort: "price_asc", CreatedAt: time.Date(2025, 3, 1, 12, 30, 0, 123456000, time.UTC), Price: 1950, ID: 42}
+
+	decoded, err := decodeCursor(encodeCursor(c))
+	assert.NoError(t, err)
+	assert.Equal(t, "price_asc", decoded.Sort)
+	assert.True(t, c.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, Money(1950), decoded.Price)
+	assert.Equal(t, 42, decoded.ID)
+
+	c = listingCursor{Sort: "distance", CreatedAt: c.CreatedAt, Distance: 3.25, ID: 7}
+	decoded, err = decodeCursor(encodeCursor(c))
+	assert.NoError(t, err)
+	assert.Equal(t, 3.25, decoded.Distance)
+
+	// Cursors without a distance part are still accepted.
+	decoded, err = decodeCursor(encodeRaw("newest|2025-03-01T12:30:00Z|10|5"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, decoded.ID)
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	bad := []string{
+		"!!!",
+		encodeRaw("nopipe"),
+		encodeRaw("newest|2025-03-01T12:30:00Z|10|abc"),
+		encodeRaw("newest|yesterday|10|1"),
+		encodeRaw("distance|2025-03-01T12:30:00Z|10|1|far"),
+	}
+	for _, token := range bad {
+		_, err := decodeCursor(token)
+		assert.Error(t, err, token)
+	}
+}
+
+func encodeRaw(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"Defaults", "/listings", defaultPageLimit, false},
+		{"Custom limit", "/listings?limit=5", 5, false},
+		{"Limit capped", "/listings?limit=1000", maxPageLimit, false},
+		{"Zero limit", "/listings?limit=0", 0, true},
+		{"Non-numeric limit", "/listings?limit=abc", 0, true},
+		{"Bad cursor", "/listings?cursor=not-a-cursor", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			limit, cursor, err := parsePageParams(req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLimit, limit)
+			assert.Nil(t, cursor)
+		})
+	}
+}
+
+func TestNewListingsPage(t *testing.T) {
+	now := time.Now()
+	listings := []Listing{
+		{ID: 3, CreatedAt: now},
+		{ID: 2, CreatedAt: now.Add(-time.Minute)},
+		{ID: 1, CreatedAt: now.Add(-2 * time.Minute)},
+	}
+
+	page := newListingsPage(listings, 2, "newest")
+	assert.Len(t, page.Listings, 2)
+	next, err := decodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, next.ID)
+	assert.Equal(t, "newest", next.Sort)
+
+	last := newListingsPage(listings, 3, "newest")
+	assert.Len(t, last.Listings, 3)
+	assert.Empty(t, last.NextCursor)
+
+	empty := newListingsPage(nil, 20, "newest")
+	assert.NotNil(t, empty.Listings)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PickupLocation is where a listing is handed over. Named campus spots come
+// from the pickup_locations table; a listing may instead give its own
+// coordinates, in which case ID and Name are empty.
+type PickupLocation struct {
+	ID   int     `json:"id,omitempty"`
+	Slug string  `json:"slug,omitempty"`
+	Name string  `json:"name,omitempty"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// defaultPickupLocations are the built-in campus meeting spots.
+var defaultPickupLocations = []PickupLocation{
+	{Slug: "reitz-union", Name: "Reitz Union", Lat: 29.6463, Lon: -82.3478},
+	{Slug: "library-west", Name: "Library West", Lat: 29.6519, Lon: -82.3429},
+	{Slug: "marston-library", Name: "Marston Science Library", Lat: 29.6480, Lon: -82.3438},
+	{Slug: "turlington-plaza", Name: "Turlington Plaza", Lat: 29.6492, Lon: -82.3435},
+	{Slug: "southwest-rec", Name: "Southwest Recreation Center", Lat: 29.6385, Lon: -82.3686},
+	{Slug: "broward-hall", Name: "Broward Hall", Lat: 29.6461, Lon: -82.3387},
+	{Slug: "hume-hall", Name: "Hume Hall", Lat: 29.6437, Lon: -82.3514},
+	{Slug: "stadium", Name: "Ben Hill Griffin Stadium", Lat: 29.6500, Lon: -82.3486},
+}
+
+// Distance search limits, in kilometres.
+const (
+	defaultSearchRadiusKm = 10
+	maxSearchRadiusKm     = 500
+)
+
+// initPickupLocationsDB creates and seeds pickup_locations and adds the
+// pickup columns to listings. A listing has either a pickup location or its
+// own coordinates, never both.
+func initPickupLocationsDB() error {
+	pickupSchema := `
+	CREATE TABLE IF NOT EXISTS pickup_locations (
+		id SERIAL PRIMARY KEY,
+		slug TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		lat DOUBLE PRECISION NOT NULL CHECK (lat BETWEEN -90 AND 90),
+		lon DOUBLE PRECISION NOT NULL CHECK (lon BETWEEN -180 AND 180)
+	);
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS pickup_location_id INTEGER REFERENCES pickup_locations(id) ON DELETE SET NULL;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS pickup_lat DOUBLE PRECISION;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS pickup_lon DOUBLE PRECISION;
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'listings_pickup_check') THEN
+			ALTER TABLE listings ADD CONSTRAINT listings_pickup_check CHECK (
+				(pickup_lat IS NULL) = (pickup_lon IS NULL)
+				AND (pickup_lat IS NULL OR pickup_location_id IS NULL)
+				AND (pickup_lat IS NULL OR pickup_lat BETWEEN -90 AND 90)
+				AND (pickup_lon IS NULL OR pickup_lon BETWEEN -180 AND 180));
+		END IF;
+	END $$;
+	CREATE INDEX IF NOT EXISTS idx_listings_pickup_location ON listings (pickup_location_id);`
+	if _, err := db.Exec(pickupSchema); err != nil {
+		return fmt.Errorf("error creating pickup_locations table: %v", err)
+	}
+
+	for _, p := range defaultPickupLocations {
+		if _, err := db.Exec(
+			"INSERT INTO pickup_locations(slug, name, lat, lon) VALUES($1, $2, $3, $4) ON CONFLICT (slug) DO NOTHING",
+			p.Slug, p.Name, p.Lat, p.Lon,
+		); err != nil {
+			return fmt.Errorf("error seeding pickup location %s: %v", p.Slug, err)
+		}
+	}
+	return nil
+}
+
+// Effective pickup coordinates of the listing aliased as l, which must be
+// joined to pickup_locations as pl (see listingFrom).
+const (
+	pickupLatSQL = "COALESCE(l.pickup_lat, pl.lat)"
+	pickupLonSQL = "COALESCE(l.pickup_lon, pl.lon)"
+)
+
+// haversineSQL returns an SQL expression for the great-circle distance in
+// kilometres between a listing's pickup point and the point bound to the
+// latParam and lonParam placeholders. It is NULL for listings without one.
+func haversineSQL(latParam, lonParam string) string {
+	return fmt.Sprintf(
+		"(6371 * 2 * ASIN(SQRT(LEAST(1, POWER(SIN(RADIANS(%[1]s - %[3]s) / 2), 2)"+
+			" + COS(RADIANS(%[3]s)) * COS(RADIANS(%[1]s)) * POWER(SIN(RADIANS(%[2]s - %[4]s) / 2), 2)))))",
+		pickupLatSQL, pickupLonSQL, latParam, lonParam)
+}
+
+// geoPoint is a latitude/longitude pair in degrees.
+type geoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// parseGeoPoint parses "lat,lon".
+func parseGeoPoint(raw string) (geoPoint, error) {
+	latStr, lonStr, ok := strings.Cut(raw, ",")
+	if !ok {
+		return geoPoint{}, fmt.Errorf("near must be lat,lon")
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return geoPoint{}, fmt.Errorf("invalid latitude")
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return geoPoint{}, fmt.Errorf("invalid longitude")
+	}
+	return geoPoint{Lat: lat, Lon: lon}, nil
+}
+
+// pickupInput is the pickup information sent with a listing form. Set is
+// false when the form does not mention pickup at all.
+type pickupInput struct {
+	Set        bool
+	LocationID sql.NullInt64
+	Lat        sql.NullFloat64
+	Lon        sql.NullFloat64
+}
+
+// errUnknownPickupLocation is returned by resolvePickupLocation for unknown spots.
+var errUnknownPickupLocation = errors.New("unknown pickup location")
+
+// resolvePickupLocation looks up a named pickup spot by slug, name or id.
+var resolvePickupLocation = func(input string) (int, error) {
+	var id int
+	err := db.QueryRow(
+		"SELECT id FROM pickup_locations WHERE lower(slug) = lower($1) OR lower(name) = lower($1) OR id::text = $1 LIMIT 1",
+		strings.TrimSpace(input),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w %q", errUnknownPickupLocation, input)
+	}
+	return id, err
+}
+
+// parsePickupForm reads the pickupLocation field, or the pickupLat and
+// pickupLon pair, from a listing form. Sending an empty pickupLocation on
+// its own clears the pickup point.
+func parsePickupForm(form url.Values) (pickupInput, error) {
+	_, locationSent := form["pickupLocation"]
+	location := strings.TrimSpace(form.Get("pickupLocation"))
+	latStr, lonStr := strings.TrimSpace(form.Get("pickupLat")), strings.TrimSpace(form.Get("pickupLon"))
+	coordinatesSent := latStr != "" || lonStr != ""
+
+	var p pickupInput
+	switch {
+	case location != "" && coordinatesSent:
+		return p, fmt.Errorf("send either pickupLocation or pickupLat and pickupLon, not both")
+	case location != "":
+		id, err := resolvePickupLocation(location)
+		if err != nil {
+			return p, err
+		}
+		p.LocationID = sql.NullInt64{Int64: int64(id), Valid: true}
+	case coordinatesSent:
+		point, err := parseGeoPoint(latStr + "," + lonStr)
+		if err != nil {
+			return p, err
+		}
+		p.Lat = sql.NullFloat64{Float64: point.Lat, Valid: true}
+		p.Lon = sql.NullFloat64{Float64: point.Lon, Valid: true}
+	case !locationSent:
+		return p, nil
+	}
+	p.Set = true
+	return p, nil
+}
+
+// getPickupLocations returns the named pickup spots in alphabetical order.
+var getPickupLocations = func() ([]PickupLocation, error) {
+	rows, err := db.Query("SELECT id, slug, name, lat, lon FROM pickup_locations ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []PickupLocation{}
+	for rows.Next() {
+		var p PickupLocation
+		if err := rows.Scan(&p.ID, &p.Slug, &p.Name, &p.Lat, &p.Lon); err != nil {
+			return nil, err
+		}
+		locations = append(locations, p)
+	}
+	return locations, rows.Err()
+}
+
+// pickupLocationsHandler handles GET /pickup-locations.
+func pickupLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locations, err := getPickupLocations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locations)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeoPoint(t *testing.T) {
+	p, err := parseGeoPoint("29.6463,-82.3478")
+	assert.NoError(t, err)
+	assert.Equal(t, geoPoint{Lat: 29.6463, Lon: -82.3478}, p)
+
+	for _, raw := range []string{"", "29.6", "abc,1", "-91,0", "0,181"} {
+		_, err := parseGeoPoint(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestParsePickupForm(t *testing.T) {
+	original := resolvePickupLocation
+	defer func() { resolvePickupLocation = original }()
+	resolvePickupLocation = func(input string) (int, error) {
+		if input == "reitz-union" {
+			return 3, nil
+		}
+		return 0, errUnknownPickupLocation
+	}
+
+	p, err := parsePickupForm(url.Values{})
+	assert.NoError(t, err)
+	assert.False(t, p.Set)
+
+	p, err = parsePickupForm(url.Values{"pickupLocation": {"reitz-union"}})
+	assert.NoError(t, err)
+	assert.True(t, p.Set)
+	assert.Equal(t, sql.NullInt64{Int64: 3, Valid: true}, p.LocationID)
+	assert.False(t, p.Lat.Valid)
+
+	p, err = parsePickupForm(url.Values{"pickupLat": {"29.65"}, "pickupLon": {"-82.34"}})
+	assert.NoError(t, err)
+	assert.True(t, p.Set)
+	assert.False(t, p.LocationID.Valid)
+	assert.Equal(t, 29.65, p.Lat.Float64)
+	assert.Equal(t, -82.34, p.Lon.Float64)
+
+	p, err = parsePickupForm(url.Values{"pickupLocation": {""}})
+	assert.NoError(t, err)
+	assert.True(t, p.Set)
+	assert.False(t, p.LocationID.Valid || p.Lat.Valid)
+
+	invalid := []url.Values{
+		{"pickupLocation": {"moon"}},
+		{"pickupLocation": {"reitz-union"}, "pickupLat": {"29.65"}, "pickupLon": {"-82.34"}},
+		{"pickupLat": {"29.65"}},
+		{"pickupLat": {"95"}, "pickupLon": {"0"}},
+	}
+	for _, form := range invalid {
+		_, err := parsePickupForm(form)
+		assert.Error(t, err, form.Encode())
+	}
+}
+
+func TestPickupLocationsHandler(t *testing.T) {
+	original := getPickupLocations
+	defer func() { getPickupLocations = original }()
+	getPickupLocations = func() ([]PickupLocation, error) {
+		return []PickupLocation{{ID: 1, Slug: "library-west", Name: "Library West", Lat: 29.6519, Lon: -82.3429}}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	pickupLocationsHandler(rr, httptest.NewRequest(http.MethodGet, "/pickup-locations", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var locations []PickupLocation
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &locations))
+	assert.Equal(t, "Library West", locations[0].Name)
+
+	rr = httptest.NewRecorder()
+	pickupLocationsHandler(rr, httptest.NewRequest(http.MethodPost, "/pickup-locations", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Report reasons.
+const (
+	ReportScam       = "scam"
+	ReportProhibited = "prohibited"
+	ReportDuplicate  = "duplicate"
+	ReportSpam       = "spam"
+	ReportOffensive  = "offensive"
+	ReportOther      = "other"
+	// ReportScreening is used for listings flagged by content screening.
+	// Users cannot choose it.
+	ReportScreening = "screening"
+)
+
+var reportReasons = map[string]bool{
+	ReportScam: true, ReportProhibited: true, ReportDuplicate: true,
+	ReportSpam: true, ReportOffensive: true, ReportOther: true,
+}
+
+// Report statuses. Open and triaged reports are still under review;
+// dismissed and actioned ones are closed.
+const (
+	ReportOpen      = "open"
+	ReportTriaged   = "triaged"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// openReportStatuses are the statuses that count towards hiding a listing.
+var openReportStatuses = []string{ReportOpen, ReportTriaged}
+
+const (
+	defaultReportHideThreshold = 3
+	maxReportNoteLength        = 1000
+)
+
+// reportHideThreshold is how many users must report a listing before it is
+// hidden from the feed pending review.
+func reportHideThreshold() int {
+	if n := appConfig.Listings.ReportHideThreshold; n > 0 {
+		return n
+	}
+	return defaultReportHideThreshold
+}
+
+// initReportsDB creates the reports table and adds hidden_at to listings,
+// which is set while a listing is hidden pending review. A user has at most
+// one report under review per listing. Reports from content screening have
+// no reporter.
+func initReportsDB() error {
+	reportsSchema := `
+	CREATE TABLE IF NOT EXISTS reports (
+		id SERIAL PRIMARY KEY,
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		reporter_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		reason TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		moderator_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		resolution_note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		resolved_at TIMESTAMPTZ
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_reporter ON reports (listing_id, reporter_id) WHERE status IN ('open', 'triaged');
+	CREATE INDEX IF NOT EXISTS idx_reports_status_created_at ON reports (status, created_at);
+	ALTER TABLE reports ALTER COLUMN reporter_id DROP NOT NULL;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ;`
+	if _, err := db.Exec(reportsSchema); err != nil {
+		return fmt.Errorf("error creating reports table: %v", err)
+	}
+	return nil
+}
+
+// Report is a user's report of a listing. ReporterID is nil for reports
+// from content screening. ListingName, ListingHidden and OpenReports are
+// filled in for the moderation queue.
+type Report struct {
+	ID             int        `json:"id"`
+	ListingID      int        `json:"listingId"`
+	ReporterID     *int       `json:"reporterId"`
+	Reason         string     `json:"reason"`
+	Note           string     `json:"note"`
+	Status         string     `json:"status"`
+	ModeratorID    *int       `json:"moderatorId"`
+	ResolutionNote string     `json:"resolutionNote"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	ListingName    string     `json:"listingName,omitempty"`
+	ListingHidden  bool       `json:"listingHidden"`
+	OpenReports    int        `json:"openReports,omitempty"`
+}
+
+// Errors returned by the report functions.
+var (
+	errAlreadyReported = errors.New("you have already reported this listing")
+	errReportClosed    = errors.New("report is already resolved")
+)
+
+// createReport stores a report and hides the listing once enough users
+// have open reports on it. The listing row is locked so that concurrent
+// reports are counted one after another. It returns whether this report
+// hid the listing.
+var createReport = func(listingID, reporterID int, reason, note string) (Report, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Report{}, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM listings WHERE id = $1 FOR UPDATE", listingID); err != nil {
+		return Report{}, false, err
+	}
+	r := Report{ListingID: listingID, ReporterID: &reporterID, Reason: reason, Note: note, Status: ReportOpen}
+	err = tx.QueryRow(
+		`INSERT INTO reports(listing_id, reporter_id, reason, note) VALUES($1, $2, $3, $4)
+		ON CONFLICT (listing_id, reporter_id) WHERE status IN ('open', 'triaged') DO NOTHING
+		RETURNING id, created_at`,
+		listingID, reporterID, reason, note,
+	).Scan(&r.ID, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Report{}, false, errAlreadyReported
+	}
+	if err != nil {
+		return Report{}, false, err
+	}
+
+	res, err := tx.Exec(
+		`UPDATE listings SET hidden_at = $1 WHERE id = $2 AND hidden_at IS NULL
+		AND (SELECT COUNT(DISTINCT reporter_id) FROM reports WHERE listing_id = $2 AND status = ANY($3)) >= $4`,
+		time.Now(), listingID, pq.Array(openReportStatuses), reportHideThreshold(),
+	)
+	if err != nil {
+		return Report{}, false, err
+	}
+	hidden, err := res.RowsAffected()
+	if err != nil {
+		return Report{}, false, err
+	}
+	r.ListingHidden = hidden == 1
+	return r, r.ListingHidden, tx.Commit()
+}
+
+const reportColumns = `r.id, r.listing_id, r.reporter_id, r.reason, r.note, r.status, r.moderator_id, r.resolution_note, r.created_at, r.resolved_at,
+	l.product_name, l.hidden_at IS NOT NULL,
+	(SELECT COUNT(*) FROM reports o WHERE o.listing_id = r.listing_id AND o.status IN ('open', 'triaged'))`
+
+func scanReport(row rowScanner, r *Report) error {
+	var reporterID, moderatorID sql.NullInt64
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.ListingID, &reporterID, &r.Reason, &r.Note, &r.Status, &moderatorID, &r.ResolutionNote,
+		&r.CreatedAt, &resolvedAt, &r.ListingName, &r.ListingHidden, &r.OpenReports); err != nil {
+		return err
+	}
+	if reporterID.Valid {
+		id := int(reporterID.Int64)
+		r.ReporterID = &id
+	}
+	if moderatorID.Valid {
+		id := int(moderatorID.Int64)
+		r.ModeratorID = &id
+	}
+	if resolvedAt.Valid {
+		r.ResolvedAt = &resolvedAt.Time
+	}
+	return nil
+}
+
+// getReports returns the reports with the given statuses, oldest first so
+// the queue is worked in order.
+var getReports = func(statuses []string, limit int) ([]Report, error) {
+	rows, err := db.Query(
+		"SELECT "+reportColumns+" FROM reports r JOIN listings l ON l.id = r.listing_id WHERE r.status = ANY($1) ORDER BY r.created_at, r.id LIMIT $2",
+		pq.Array(statuses), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var r Report
+		if err := scanReport(rows, &r); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// updateReport moves a report under review to status on behalf of a
+// moderator. Actioning a report closes every open report on the listing and
+// keeps it hidden; dismissing the last open report unhides it.
+var updateReport = func(reportID, moderatorID int, status, note string) (Report, error) {
+	var listingID int
+	if err := db.QueryRow("SELECT listing_id FROM reports WHERE id = $1", reportID).Scan(&listingID); err != nil {
+		return Report{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the listing first, as createReport does.
+	if _, err := tx.Exec("SELECT 1 FROM listings WHERE id = $1 FOR UPDATE", listingID); err != nil {
+		return Report{}, err
+	}
+	var current string
+	if err := tx.QueryRow("SELECT status FROM reports WHERE id = $1 FOR UPDATE", reportID).Scan(&current); err != nil {
+		return Report{}, err
+	}
+	if current != ReportOpen && current != ReportTriaged {
+		return Report{}, errReportClosed
+	}
+
+	now := time.Now()
+	resolvedAt := sql.NullTime{Time: now, Valid: status != ReportTriaged}
+	if _, err := tx.Exec(
+		"UPDATE reports SET status = $1, moderator_id = $2, resolution_note = $3, resolved_at = $4 WHERE id = $5",
+		status, moderatorID, note, resolvedAt, reportID,
+	); err != nil {
+		return Report{}, err
+	}
+
+	switch status {
+	case ReportActioned:
+		if _, err := tx.Exec(
+			"UPDATE reports SET status = $1, moderator_id = $2, resolved_at = $3 WHERE listing_id = $4 AND status = ANY($5)",
+			ReportActioned, moderatorID, now, listingID, pq.Array(openReportStatuses),
+		); err != nil {
+			return Report{}, err
+		}
+		if _, err := tx.Exec("UPDATE listings SET hidden_at = COALESCE(hidden_at, $1) WHERE id = $2", now, listingID); err != nil {
+			return Report{}, err
+		}
+	case ReportDismissed:
+		if _, err := tx.Exec(
+			"UPDATE listings SET hidden_at = NULL WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM reports WHERE listing_id = $1 AND status = ANY($2))",
+			listingID, pq.Array(openReportStatuses),
+		); err != nil {
+			return Report{}, err
+		}
+	}
+
+	var r Report
+	if err := scanReport(tx.QueryRow("SELECT "+reportColumns+" FROM reports r JOIN listings l ON l.id = r.listing_id WHERE r.id = $1", reportID), &r); err != nil {
+		return Report{}, err
+	}
+	return r, tx.Commit()
+}
+
+// requireModerator checks that userID is a moderator or admin, writing an
+// error response if not.
+func requireModerator(w http.ResponseWriter, userID int) bool {
+	role, err := GetUserRole(userID)
+	if err != nil {
+		http.Error(w, "Error getting user details", http.StatusInternalServerError)
+		return false
+	}
+	if role != RoleModerator && role != RoleAdmin {
+		http.Error(w, "Moderator access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
+
+// reportListingHandler handles POST /listings/{id}/report, where a user
+// flags a listing for moderators with a reason code and an optional note.
+func reportListingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !reportReasons[req.Reason] {
+		http.Error(w, "Invalid reason", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxReportNoteLength {
+		http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxReportNoteLength), http.StatusBadRequest)
+		return
+	}
+	if req.Reason == ReportOther && req.Note == "" {
+		http.Error(w, "A note is required when the reason is other", http.StatusBadRequest)
+		return
+	}
+
+	l, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if l.Status == StatusDraft {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return
+	}
+	if l.UserID == currentUserID {
+		http.Error(w, "You cannot report your own listing", http.StatusBadRequest)
+		return
+	}
+
+	report, hidden, err := createReport(listingID, currentUserID, req.Reason, req.Note)
+	if err != nil {
+		if errors.Is(err, errAlreadyReported) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hidden {
+		log.Printf("Listing %d hidden pending review after reaching %d reports", listingID, reportHideThreshold())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Moderation queue paging.
+const (
+	defaultReportsLimit = 50
+	maxReportsLimit     = 200
+)
+
+// moderationReportsHandler handles GET /moderation/reports?status=&limit=
+// and returns the moderation queue. status is a comma-separated list and
+// defaults to the reports still under review.
+func moderationReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+	statuses := openReportStatuses
+	if raw := r.URL.Query().Get("status"); raw != "" {
+		statuses = strings.Split(raw, ",")
+		for _, s := range statuses {
+			switch s {
+			case ReportOpen, ReportTriaged, ReportDismissed, ReportActioned:
+			default:
+				http.Error(w, "Invalid status", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	limit := defaultReportsLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxReportsLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxReportsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	if !requireModerator(w, currentUserID) {
+		return
+	}
+
+	reports, err := getReports(statuses, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reports": reports,
+	})
+}
+
+type reportUpdateRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// moderationReportHandler handles PUT /moderation/reports/{id}, where a
+// moderator triages a report or resolves it as dismissed or actioned.
+func moderationReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid report id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	var req reportUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch req.Status {
+	case ReportTriaged, ReportDismissed, ReportActioned:
+	default:
+		http.Error(w, "Status must be triaged, dismissed or actioned", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxReportNoteLength {
+		http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxReportNoteLength), http.StatusBadRequest)
+		return
+	}
+	if !requireModerator(w, currentUserID) {
+		return
+	}
+
+	report, err := updateReport(reportID, currentUserID, req.Status, req.Note)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Report not found", http.StatusNotFound)
+		case errors.Is(err, errReportClosed):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateReportHidesListingAtThreshold(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT 1 FROM listings WHERE id = \\$1 FOR UPDATE").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO reports").
+		WithArgs(3, 2, ReportScam, "asks for gift cards").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(11, time.Now()))
+	mock.ExpectExec("UPDATE listings SET hidden_at = \\$1 WHERE id = \\$2 AND hidden_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 3, pq.Array(openReportStatuses), defaultReportHideThreshold).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	report, hidden, err := createReport(3, 2, ReportScam, "asks for gift cards")
+	assert.NoError(t, err)
+	assert.True(t, hidden)
+	assert.Equal(t, 11, report.ID)
+	assert.Equal(t, ReportOpen, report.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateReportDuplicate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT 1 FROM listings").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO reports").WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}))
+	mock.ExpectRollback()
+
+	_, _, err = createReport(3, 2, ReportSpam, "")
+	assert.ErrorIs(t, err, errAlreadyReported)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReportListingHandler(t *testing.T) {
+	originalGetListing := getListing
+	originalCreate := createReport
+	defer func() {
+		getListing = originalGetListing
+		createReport = originalCreate
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		switch listingID {
+		case 404:
+			return Listing{}, sql.ErrNoRows
+		case 500:
+			return Listing{}, errors.New("connection reset")
+		case 6:
+			return Listing{ID: listingID, UserID: 1, Status: StatusDraft}, nil
+		}
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive}, nil
+	}
+	createReport = func(listingID, reporterID int, reason, note string) (Report, bool, error) {
+		if reporterID == 3 {
+			return Report{}, false, errAlreadyReported
+		}
+		return Report{ID: 1, ListingID: listingID, ReporterID: &reporterID, Reason: reason, Note: note, Status: ReportOpen}, false, nil
+	}
+
+	tests := []struct {
+		name           string
+		listingID      string
+		userID         string
+		body           string
+		expectedStatus int
+	}{
+		{"Report scam", "5", "2", `{"reason":"scam","note":"too good to be true"}`, http.StatusCreated},
+		{"Unknown reason", "5", "2", `{"reason":"ugly"}`, http.StatusBadRequest},
+		{"Other needs a note", "5", "2", `{"reason":"other","note":"  "}`, http.StatusBadRequest},
+		{"Note too long", "5", "2", `{"reason":"spam","note":"` + strings.Repeat("x", maxReportNoteLength+1) + `"}`, http.StatusBadRequest},
+		{"Own listing", "5", "1", `{"reason":"spam"}`, http.StatusBadRequest},
+		{"Listing not found", "404", "2", `{"reason":"spam"}`, http.StatusNotFound},
+		{"Draft listing", "6", "2", `{"reason":"spam"}`, http.StatusNotFound},
+		{"Lookup error", "500", "2", `{"reason":"spam"}`, http.StatusInternalServerError},
+		{"Already reported", "5", "3", `{"reason":"spam"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/listings/"+tt.listingID+"/report", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			reportListingHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestModerationReportsHandler(t *testing.T) {
+	originalRole := GetUserRole
+	originalGet := getReports
+	defer func() {
+		GetUserRole = originalRole
+		getReports = originalGet
+	}()
+
+	GetUserRole = func(userID int) (string, error) {
+		if userID == 9 {
+			return RoleModerator, nil
+		}
+		return RoleUser, nil
+	}
+	var gotStatuses []string
+	getReports = func(statuses []string, limit int) ([]Report, error) {
+		gotStatuses = statuses
+		return []Report{}, nil
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		query          string
+		expectedStatus int
+		wantStatuses   []string
+	}{
+		{"Moderator sees open queue", "9", "", http.StatusOK, openReportStatuses},
+		{"Filter by status", "9", "?status=dismissed,actioned", http.StatusOK, []string{ReportDismissed, ReportActioned}},
+		{"Invalid status", "9", "?status=closed", http.StatusBadRequest, nil},
+		{"Regular user", "2", "", http.StatusForbidden, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStatuses = nil
+			req := httptest.NewRequest(http.MethodGet, "/moderation/reports"+tt.query, nil)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			moderationReportsHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.wantStatuses, gotStatuses)
+		})
+	}
+}
+
+func TestModerationReportHandler(t *testing.T) {
+	originalRole := GetUserRole
+	originalUpdate := updateReport
+	defer func() {
+		GetUserRole = originalRole
+		updateReport = originalUpdate
+	}()
+
+	GetUserRole = func(userID int) (string, error) {
+		if userID == 9 {
+			return RoleAdmin, nil
+		}
+		return RoleUser, nil
+	}
+	updateReport = func(reportID, moderatorID int, status, note string) (Report, error) {
+		switch reportID {
+		case 404:
+			return Report{}, sql.ErrNoRows
+		case 8:
+			return Report{}, errReportClosed
+		}
+		return Report{ID: reportID, Status: status, ModeratorID: &moderatorID, ResolutionNote: note}, nil
+	}
+
+	tests := []struct {
+		name           string
+		reportID       string
+		userID         string
+		body           string
+		expectedStatus int
+	}{
+		{"Triage", "7", "9", `{"status":"triaged"}`, http.StatusOK},
+		{"Action", "7", "9", `{"status":"actioned","note":"scam confirmed"}`, http.StatusOK},
+		{"Reopen not allowed", "7", "9", `{"status":"open"}`, http.StatusBadRequest},
+		{"Already resolved", "8", "9", `{"status":"dismissed"}`, http.StatusConflict},
+		{"Not found", "404", "9", `{"status":"dismissed"}`, http.StatusNotFound},
+		{"Regular user", "7", "2", `{"status":"dismissed"}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/moderation/reports/"+tt.reportID, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.reportID)
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			moderationReportHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
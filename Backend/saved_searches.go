@@ -0,0 +1,629 @@
+package main
+
+import (
+	"UFMarketPlace/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Saved search notification frequencies. Instant sends one email per match;
+// daily collects matches into one digest email a day.
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+)
+
+// Saved search limits and the digest job schedule.
+const (
+	maxSavedSearchesPerUser = 20
+	savedSearchDigestPeriod = 24 * time.Hour
+	savedSearchDigestCheck  = time.Hour
+)
+
+// SavedSearch is a feed filter a user wants to be notified about. Filters
+// uses the feed's query parameter names, e.g. {"category": "furniture",
+// "maxPrice": "50"}.
+type SavedSearch struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name"`
+	Filters   map[string]string `json:"filters"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// initSavedSearchesDB creates the saved_searches and saved_search_matches
+// tables and the per-user notification settings.
+func initSavedSearchesDB() error {
+	savedSearchesSchema := `
+	CREATE TABLE IF NOT EXISTS saved_searches (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		filters JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_saved_searches_user ON saved_searches (user_id);
+	CREATE TABLE IF NOT EXISTS saved_search_matches (
+		saved_search_id INTEGER NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		matched_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		notified_at TIMESTAMPTZ,
+		PRIMARY KEY (saved_search_id, listing_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_saved_search_matches_pending ON saved_search_matches (saved_search_id) WHERE notified_at IS NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS saved_search_frequency TEXT NOT NULL DEFAULT 'instant';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS saved_search_digest_sent_at TIMESTAMPTZ;`
+	if _, err := db.Exec(savedSearchesSchema); err != nil {
+		return fmt.Errorf("error creating saved_searches tables: %v", err)
+	}
+	return nil
+}
+
+// savedSearchFilterKeys are the feed parameters a saved search may use, in
+// addition to attr.<name>. Sorting and paging have no meaning for matching.
+var savedSearchFilterKeys = map[string]bool{
+	"category": true,
+	"minPrice": true,
+	"maxPrice": true,
+	"sellerId": true,
+	"status":   true,
+	"tag":      true,
+}
+
+// validateSavedSearchFilters checks filters with the same rules as the feed
+// and returns them with the category resolved to its slug.
+func validateSavedSearchFilters(filters map[string]string) (map[string]string, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one filter is required")
+	}
+	values := url.Values{}
+	for key, value := range filters {
+		if !savedSearchFilterKeys[key] && !strings.HasPrefix(key, "attr.") {
+			return nil, fmt.Errorf("unsupported filter %q", key)
+		}
+		values.Set(key, strings.TrimSpace(value))
+	}
+	f, err := parseListingFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	if f.Category != "" {
+		values.Set("category", f.Category)
+	}
+
+	normalized := make(map[string]string, len(values))
+	for key := range values {
+		normalized[key] = values.Get(key)
+	}
+	return normalized, nil
+}
+
+// savedSearchFilter converts stored filters back into a listingFilter. The
+// stored category is already a slug, so it is not looked up again.
+func savedSearchFilter(filters map[string]string) (listingFilter, error) {
+	values := url.Values{}
+	for key, value := range filters {
+		if key != "category" {
+			values.Set(key, value)
+		}
+	}
+	f, err := parseListingFilter(values)
+	f.Category = filters["category"]
+	return f, err
+}
+
+// matches reports whether a listing satisfies the filter. categoryPath is
+// the listing's category followed by its ancestors, so that a filter on a
+// parent category matches listings in its subcategories as on the feed.
+func (f listingFilter) matches(l Listing, categoryPath []string) bool {
+	if f.Category != "" && !containsString(categoryPath, f.Category) {
+		return false
+	}
+	if f.MinPrice != nil && l.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && l.Price > *f.MaxPrice {
+		return false
+	}
+	if f.CreatedAfter != nil && !l.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	if f.SellerID != 0 && l.UserID != f.SellerID {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !containsString(l.Tags, tag) {
+			return false
+		}
+	}
+	for name, want := range f.Attributes {
+		got, ok := l.Attributes[name]
+		if !ok || fmt.Sprint(got) != want {
+			return false
+		}
+	}
+	statuses := f.Statuses
+	if len(statuses) == 0 {
+		statuses = publicListingStatuses
+	}
+	return containsString(statuses, l.Status)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getCategoryPath returns the slug followed by the slugs of its ancestors.
+var getCategoryPath = func(slug string) ([]string, error) {
+	rows, err := db.Query(`
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, slug, 0 AS depth FROM categories WHERE slug = $1
+		UNION ALL
+		SELECT c.id, c.parent_id, c.slug, a.depth + 1 FROM categories c JOIN ancestors a ON c.id = a.parent_id
+	)
+	SELECT slug FROM ancestors ORDER BY depth`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var path []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		path = append(path, s)
+	}
+	return path, rows.Err()
+}
+
+// savedSearchCandidate is a saved search considered by the matcher, along
+// with how its owner wants to be notified.
+type savedSearchCandidate struct {
+	SavedSearch
+	UserID    int
+	Email     string
+	Frequency string
+}
+
+// savedSearchCandidatesSQL selects the saved searches, not owned by the
+// seller, whose category, price bounds, seller and status filters admit the
+// listing. Filters are stored as validated strings; an empty value means the
+// filter is unset. The remaining filters are checked by listingFilter.matches.
+const savedSearchCandidatesSQL = `
+SELECT s.id, s.name, s.filters, s.user_id, u.email, u.saved_search_frequency
+FROM saved_searches s JOIN users u ON u.id = s.user_id
+WHERE s.user_id <> $1
+	AND (NULLIF(s.filters->>'category', '') IS NULL OR s.filters->>'category' = ANY($2))
+	AND (NULLIF(s.filters->>'minPrice', '') IS NULL OR (s.filters->>'minPrice')::numeric <= $3::numeric)
+	AND (NULLIF(s.filters->>'maxPrice', '') IS NULL OR (s.filters->>'maxPrice')::numeric >= $3::numeric)
+	AND (NULLIF(s.filters->>'sellerId', '') IS NULL OR (s.filters->>'sellerId')::int = $1)
+	AND $4 = ANY(COALESCE(string_to_array(NULLIF(replace(s.filters->>'status', ' ', ''), ''), ','), $5::text[]))`
+
+// getSavedSearchCandidates returns the saved searches that may match the
+// listing, narrowed in SQL by category, price, seller and status.
+// categoryPath is the listing's category followed by its ancestors.
+var getSavedSearchCandidates = func(l Listing, categoryPath []string) ([]savedSearchCandidate, error) {
+	rows, err := db.Query(savedSearchCandidatesSQL,
+		l.UserID, pq.Array(categoryPath), l.Price, l.Status, pq.Array(publicListingStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []savedSearchCandidate
+	for rows.Next() {
+		var c savedSearchCandidate
+		var filters []byte
+		if err := rows.Scan(&c.ID, &c.Name, &filters, &c.UserID, &c.Email, &c.Frequency); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(filters, &c.Filters); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// insertSavedSearchMatch records a match. notified marks it as already
+// sent so the digest skips it. It reports false if the match was known.
+var insertSavedSearchMatch = func(savedSearchID, listingID int, notified bool) (bool, error) {
+	now := time.Now()
+	notifiedAt := sql.NullTime{Time: now, Valid: notified}
+	res, err := db.Exec(
+		`INSERT INTO saved_search_matches(saved_search_id, listing_id, matched_at, notified_at)
+		VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+		savedSearchID, listingID, now, notifiedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// matchSavedSearches checks a newly created listing against the saved
+// searches. Matches for instant subscribers are emailed right away; the rest
+// wait for the daily digest. Errors are logged, since the listing has
+// already been created.
+var matchSavedSearches = func(listingID int) {
+	l, err := getListing(listingID)
+	if err != nil {
+		log.Printf("Error loading listing %d for saved searches: %v", listingID, err)
+		return
+	}
+	if l.Status != StatusActive {
+		return
+	}
+	categoryPath, err := getCategoryPath(l.Category)
+	if err != nil {
+		log.Printf("Error loading category of listing %d for saved searches: %v", listingID, err)
+		return
+	}
+	candidates, err := getSavedSearchCandidates(l, categoryPath)
+	if err != nil {
+		log.Printf("Error loading saved searches for listing %d: %v", listingID, err)
+		return
+	}
+
+	for _, c := range candidates {
+		filter, err := savedSearchFilter(c.Filters)
+		if err != nil {
+			log.Printf("Skipping invalid saved search %d: %v", c.ID, err)
+			continue
+		}
+		if !filter.matches(l, categoryPath) {
+			continue
+		}
+		instant := c.Frequency != FrequencyDaily
+		if instant {
+			if err := utils.SendSavedSearchMatch(c.Email, c.Name, l.ProductName, l.Price.String()); err != nil {
+				log.Printf("Error sending saved search %d match: %v", c.ID, err)
+				// Leave it for the digest rather than losing it.
+				instant = false
+			}
+		}
+		if _, err := insertSavedSearchMatch(c.ID, listingID, instant); err != nil {
+			log.Printf("Error recording saved search %d match: %v", c.ID, err)
+		}
+	}
+}
+
+// savedSearchDigestJob returns the background job that sends daily digests.
+func savedSearchDigestJob() scheduledJob {
+	return scheduledJob{Name: "saved-search-digests", Interval: savedSearchDigestCheck, Run: sendSavedSearchDigests}
+}
+
+// sendSavedSearchDigests emails each daily subscriber whose last digest is
+// at least a day old a summary of their pending matches, and marks them sent.
+func sendSavedSearchDigests() error {
+	now := time.Now()
+	rows, err := db.Query(
+		`SELECT u.id, u.email, s.name, l.product_name, l.price
+		FROM saved_search_matches m
+		JOIN saved_searches s ON s.id = m.saved_search_id
+		JOIN users u ON u.id = s.user_id
+		JOIN listings l ON l.id = m.listing_id
+		WHERE m.notified_at IS NULL AND l.deleted_at IS NULL
+			AND u.saved_search_frequency = $1
+			AND (u.saved_search_digest_sent_at IS NULL OR u.saved_search_digest_sent_at <= $2)
+		ORDER BY u.id, m.matched_at`,
+		FrequencyDaily, now.Add(-savedSearchDigestPeriod),
+	)
+	if err != nil {
+		return err
+	}
+
+	type digest struct {
+		email   string
+		matches []utils.SavedSearchMatch
+	}
+	var userIDs []int
+	digests := map[int]*digest{}
+	for rows.Next() {
+		var userID int
+		var email string
+		var m utils.SavedSearchMatch
+		var price Money
+		if err := rows.Scan(&userID, &email, &m.SearchName, &m.ProductName, &price); err != nil {
+			rows.Close()
+			return err
+		}
+		m.Price = price.String()
+		d, ok := digests[userID]
+		if !ok {
+			d = &digest{email: email}
+			digests[userID] = d
+			userIDs = append(userIDs, userID)
+		}
+		d.matches = append(d.matches, m)
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		d := digests[userID]
+		if err := utils.SendSavedSearchDigest(d.email, d.matches); err != nil {
+			log.Printf("Error sending saved search digest to user %d: %v", userID, err)
+			continue
+		}
+		// Only matches found before this run are marked, so ones recorded
+		// while the email was being sent go out in the next digest.
+		if _, err := db.Exec(
+			`UPDATE saved_search_matches SET notified_at = $1
+			WHERE notified_at IS NULL AND matched_at <= $1
+				AND saved_search_id IN (SELECT id FROM saved_searches WHERE user_id = $2)`,
+			now, userID,
+		); err != nil {
+			log.Printf("Error marking saved search digest for user %d: %v", userID, err)
+		}
+		if _, err := db.Exec("UPDATE users SET saved_search_digest_sent_at = $1 WHERE id = $2", now, userID); err != nil {
+			log.Printf("Error marking saved search digest for user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// getSavedSearches returns the user's saved searches, newest first.
+var getSavedSearches = func(userID int) ([]SavedSearch, error) {
+	rows, err := db.Query(
+		"SELECT id, name, filters, created_at FROM saved_searches WHERE user_id = $1 ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		var s SavedSearch
+		var filters []byte
+		if err := rows.Scan(&s.ID, &s.Name, &filters, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(filters, &s.Filters); err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+// errTooManySavedSearches is returned by createSavedSearch at the per-user limit.
+var errTooManySavedSearches = fmt.Errorf("a user can have at most %d saved searches", maxSavedSearchesPerUser)
+
+// createSavedSearch stores a new saved search for the user.
+var createSavedSearch = func(userID int, name string, filters map[string]string) (SavedSearch, error) {
+	s := SavedSearch{Name: name, Filters: filters}
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return s, err
+	}
+	err = db.QueryRow(
+		`INSERT INTO saved_searches(user_id, name, filters, created_at)
+		SELECT $1, $2, $3, $4
+		WHERE (SELECT COUNT(*) FROM saved_searches WHERE user_id = $1) < $5
+		RETURNING id, created_at`,
+		userID, name, data, time.Now(), maxSavedSearchesPerUser,
+	).Scan(&s.ID, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return s, errTooManySavedSearches
+	}
+	return s, err
+}
+
+// updateSavedSearch replaces the name and filters of one of the user's
+// saved searches. It returns sql.ErrNoRows if the user has no such search.
+var updateSavedSearch = func(userID, id int, name string, filters map[string]string) (SavedSearch, error) {
+	s := SavedSearch{ID: id, Name: name, Filters: filters}
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return s, err
+	}
+	err = db.QueryRow(
+		"UPDATE saved_searches SET name = $1, filters = $2 WHERE id = $3 AND user_id = $4 RETURNING created_at",
+		name, data, id, userID,
+	).Scan(&s.CreatedAt)
+	return s, err
+}
+
+// deleteSavedSearch removes one of the user's saved searches and reports
+// whether it existed.
+var deleteSavedSearch = func(userID, id int) (bool, error) {
+	res, err := db.Exec("DELETE FROM saved_searches WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// savedSearchRequest is the body of POST and PUT saved search requests.
+type savedSearchRequest struct {
+	Name    string            `json:"name"`
+	Filters map[string]string `json:"filters"`
+}
+
+// decodeSavedSearchRequest reads and validates a saved search body.
+func decodeSavedSearchRequest(r *http.Request) (savedSearchRequest, error) {
+	var req savedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request body")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return req, fmt.Errorf("name is required")
+	}
+	filters, err := validateSavedSearchFilters(req.Filters)
+	if err != nil {
+		return req, err
+	}
+	req.Filters = filters
+	return req, nil
+}
+
+// savedSearchesHandler handles GET /saved-searches, which lists the user's
+// saved searches, and POST /saved-searches, which creates one.
+func savedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		searches, err := getSavedSearches(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(searches)
+
+	case http.MethodPost:
+		req, err := decodeSavedSearchRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s, err := createSavedSearch(userID, req.Name, req.Filters)
+		if err != nil {
+			if errors.Is(err, errTooManySavedSearches) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// savedSearchHandler handles PUT and DELETE /saved-searches/{id}.
+func savedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid saved search id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		req, err := decodeSavedSearchRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s, err := updateSavedSearch(userID, id, req.Name, req.Filters)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Saved search not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+
+	case http.MethodDelete:
+		deleted, err := deleteSavedSearch(userID, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Saved search not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Saved search deleted successfully"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getSavedSearchFrequency returns how the user wants saved search matches delivered.
+var getSavedSearchFrequency = func(userID int) (string, error) {
+	var frequency string
+	err := db.QueryRow("SELECT saved_search_frequency FROM users WHERE id = $1", userID).Scan(&frequency)
+	return frequency, err
+}
+
+// setSavedSearchFrequency changes how the user wants saved search matches delivered.
+var setSavedSearchFrequency = func(userID int, frequency string) error {
+	_, err := db.Exec("UPDATE users SET saved_search_frequency = $1 WHERE id = $2", frequency, userID)
+	return err
+}
+
+// savedSearchSettingsHandler handles GET and PUT /saved-searches/settings,
+// which hold the user's notification frequency: {"frequency": "instant"} or
+// {"frequency": "daily"}.
+func savedSearchSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	var settings struct {
+		Frequency string `json:"frequency"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		settings.Frequency, err = getSavedSearchFrequency(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if settings.Frequency != FrequencyInstant && settings.Frequency != FrequencyDaily {
+			http.Error(w, "frequency must be instant or daily", http.StatusBadRequest)
+			return
+		}
+		if err := setSavedSearchFrequency(userID, settings.Frequency); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
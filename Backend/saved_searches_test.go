@@ -0,0 +1,242 @@
+package main
+
+import (
+	"UFMarketPlace/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSavedSearchFilters(t *testing.T) {
+	originalResolve := resolveCategory
+	defer func() { resolveCategory = originalResolve }()
+	resolveCategory = func(input string) (string, error) {
+		if strings.EqualFold(input, "furniture") {
+			return "furniture", nil
+		}
+		return "", fmt.Errorf("%w %q", errUnknownCategory, input)
+	}
+
+	filters, err := validateSavedSearchFilters(map[string]string{"category": "Furniture", "maxPrice": " 50 "})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"category": "furniture", "maxPrice": "50"}, filters)
+
+	_, err = validateSavedSearchFilters(map[string]string{})
+	assert.Error(t, err)
+	_, err = validateSavedSearchFilters(map[string]string{"sort": "newest"})
+	assert.EqualError(t, err, `unsupported filter "sort"`)
+	_, err = validateSavedSearchFilters(map[string]string{"maxPrice": "cheap"})
+	assert.Error(t, err)
+	_, err = validateSavedSearchFilters(map[string]string{"category": "toys"})
+	assert.ErrorIs(t, err, errUnknownCategory)
+}
+
+func TestListingFilterMatches(t *testing.T) {
+	l := Listing{UserID: 2, Price: 4000, Category: "desks-chairs", Status: StatusActive,
+		Attributes: map[string]interface{}{"condition": "good"}}
+	path := []string{"desks-chairs", "furniture"}
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    bool
+	}{
+		{"parent category and price", map[string]string{"category": "furniture", "maxPrice": "50"}, true},
+		{"over max price", map[string]string{"maxPrice": "30"}, false},
+		{"under min price", map[string]string{"minPrice": "45"}, false},
+		{"other category", map[string]string{"category": "books"}, false},
+		{"attribute", map[string]string{"attr.condition": "good"}, true},
+		{"attribute mismatch", map[string]string{"attr.condition": "new"}, false},
+		{"seller", map[string]string{"sellerId": "3"}, false},
+		{"status", map[string]string{"status": "sold"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := savedSearchFilter(tt.filters)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, f.matches(l, path))
+		})
+	}
+}
+
+func TestMatchSavedSearches(t *testing.T) {
+	originalGetListing := getListing
+	originalPath := getCategoryPath
+	originalCandidates := getSavedSearchCandidates
+	originalInsert := insertSavedSearchMatch
+	originalSend := utils.SendSavedSearchMatch
+	defer func() {
+		getListing = originalGetListing
+		getCategoryPath = originalPath
+		getSavedSearchCandidates = originalCandidates
+		insertSavedSearchMatch = originalInsert
+		utils.SendSavedSearchMatch = originalSend
+	}()
+
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, ProductName: "Desk", Price: 4000, Category: "desks-chairs", Status: StatusActive}, nil
+	}
+	getCategoryPath = func(slug string) ([]string, error) { return []string{"desks-chairs", "furniture"}, nil }
+	getSavedSearchCandidates = func(l Listing, categoryPath []string) ([]savedSearchCandidate, error) {
+		return []savedSearchCandidate{
+			{SavedSearch: SavedSearch{ID: 1, Name: "Cheap furniture", Filters: map[string]string{"category": "furniture", "maxPrice": "50"}}, UserID: 2, Email: "a@ufl.edu", Frequency: FrequencyInstant},
+			{SavedSearch: SavedSearch{ID: 2, Name: "Desks", Filters: map[string]string{"category": "desks-chairs"}}, UserID: 3, Email: "b@ufl.edu", Frequency: FrequencyDaily},
+			{SavedSearch: SavedSearch{ID: 3, Name: "Books", Filters: map[string]string{"category": "books"}}, UserID: 4, Email: "c@ufl.edu", Frequency: FrequencyInstant},
+		}, nil
+	}
+	notified := map[int]bool{}
+	insertSavedSearchMatch = func(savedSearchID, listingID int, isNotified bool) (bool, error) {
+		notified[savedSearchID] = isNotified
+		return true, nil
+	}
+	var emailed []string
+	utils.SendSavedSearchMatch = func(to, searchName, productName, price string) error {
+		emailed = append(emailed, to+" "+price)
+		return nil
+	}
+
+	matchSavedSearches(9)
+
+	assert.Equal(t, []string{"a@ufl.edu 40.00"}, emailed)
+	assert.Equal(t, map[int]bool{1: true, 2: false}, notified)
+}
+
+func TestGetSavedSearchCandidates(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	path := []string{"desks-chairs", "furniture"}
+	mock.ExpectQuery("s.filters->>'category' = ANY\\(\\$2\\).*\\(s.filters->>'maxPrice'\\)::numeric >= \\$3::numeric").
+		WithArgs(1, pq.Array(path), Money(4000), StatusActive, pq.Array(publicListingStatuses)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "filters", "user_id", "email", "saved_search_frequency"}).
+			AddRow(2, "Cheap furniture", []byte(`{"category":"furniture","maxPrice":"50"}`), 2, "a@ufl.edu", FrequencyInstant))
+
+	candidates, err := getSavedSearchCandidates(Listing{UserID: 1, Price: 4000, Status: StatusActive}, path)
+
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, map[string]string{"category": "furniture", "maxPrice": "50"}, candidates[0].Filters)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavedSearchesHandler(t *testing.T) {
+	originalResolve := resolveCategory
+	originalCreate := createSavedSearch
+	originalGet := getSavedSearches
+	defer func() {
+		resolveCategory = originalResolve
+		createSavedSearch = originalCreate
+		getSavedSearches = originalGet
+	}()
+	resolveCategory = func(input string) (string, error) { return strings.ToLower(input), nil }
+	createSavedSearch = func(userID int, name string, filters map[string]string) (SavedSearch, error) {
+		if userID == 9 {
+			return SavedSearch{}, errTooManySavedSearches
+		}
+		return SavedSearch{ID: 1, Name: name, Filters: filters}, nil
+	}
+	getSavedSearches = func(userID int) ([]SavedSearch, error) {
+		return []SavedSearch{{ID: 1, Name: "Cheap furniture"}}, nil
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		userID         string
+		body           string
+		expectedStatus int
+	}{
+		{"list", http.MethodGet, "1", "", http.StatusOK},
+		{"create", http.MethodPost, "1", `{"name": "Cheap furniture", "filters": {"category": "Furniture", "maxPrice": "50"}}`, http.StatusCreated},
+		{"missing name", http.MethodPost, "1", `{"filters": {"maxPrice": "50"}}`, http.StatusBadRequest},
+		{"invalid filter", http.MethodPost, "1", `{"name": "x", "filters": {"minPrice": "-1"}}`, http.StatusBadRequest},
+		{"limit reached", http.MethodPost, "9", `{"name": "x", "filters": {"maxPrice": "50"}}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/saved-searches", strings.NewReader(tt.body))
+			req.Header.Set("userId", tt.userID)
+			rr := httptest.NewRecorder()
+
+			savedSearchesHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestSavedSearchHandler(t *testing.T) {
+	originalUpdate := updateSavedSearch
+	originalDelete := deleteSavedSearch
+	defer func() {
+		updateSavedSearch = originalUpdate
+		deleteSavedSearch = originalDelete
+	}()
+	updateSavedSearch = func(userID, id int, name string, filters map[string]string) (SavedSearch, error) {
+		if id != 1 {
+			return SavedSearch{}, sql.ErrNoRows
+		}
+		return SavedSearch{ID: id, Name: name, Filters: filters}, nil
+	}
+	deleteSavedSearch = func(userID, id int) (bool, error) { return id == 1, nil }
+
+	tests := []struct {
+		name           string
+		method         string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{"update", http.MethodPut, "1", `{"name": "Desks", "filters": {"maxPrice": "80"}}`, http.StatusOK},
+		{"update missing", http.MethodPut, "2", `{"name": "Desks", "filters": {"maxPrice": "80"}}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, "1", "", http.StatusOK},
+		{"delete missing", http.MethodDelete, "2", "", http.StatusNotFound},
+		{"invalid id", http.MethodDelete, "abc", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/saved-searches/"+tt.id, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			req.Header.Set("userId", "1")
+			rr := httptest.NewRecorder()
+
+			savedSearchHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestSavedSearchSettingsHandler(t *testing.T) {
+	originalSet := setSavedSearchFrequency
+	defer func() { setSavedSearchFrequency = originalSet }()
+	var saved string
+	setSavedSearchFrequency = func(userID int, frequency string) error {
+		saved = frequency
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/saved-searches/settings", strings.NewReader(`{"frequency": "daily"}`))
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+	savedSearchSettingsHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, FrequencyDaily, saved)
+
+	req = httptest.NewRequest(http.MethodPut, "/saved-searches/settings", strings.NewReader(`{"frequency": "weekly"}`))
+	req.Header.Set("userId", "1")
+	rr = httptest.NewRecorder()
+	savedSearchSettingsHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// scheduledJob is a background task run periodically inside the server
+// process. A job with RunOnStop is run one last time when the scheduler stops.
+type scheduledJob struct {
+	Name      string
+	Interval  time.Duration
+	Run       func() error
+	RunOnStop bool
+}
+
+// startScheduler runs each job once immediately and then on its interval,
+// each in its own goroutine. Errors are logged and do not stop the job.
+// The returned function stops all jobs and waits for running ones, and the
+// final runs of RunOnStop jobs, to finish.
+func startScheduler(jobs []scheduledJob) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+			for {
+				if err := job.Run(); err != nil {
+					log.Printf("Scheduled job %s failed: %v", job.Name, err)
+				}
+				select {
+				case <-done:
+					if job.RunOnStop {
+						if err := job.Run(); err != nil {
+							log.Printf("Scheduled job %s failed on stop: %v", job.Name, err)
+						}
+					}
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartSchedulerRunsJobsUntilStopped(t *testing.T) {
+	var runs, failures int32
+	stop := startScheduler([]scheduledJob{
+		{Name: "counter", Interval: 5 * time.Millisecond, Run: func() error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}},
+		{Name: "failing", Interval: 5 * time.Millisecond, Run: func() error {
+			atomic.AddInt32(&failures, 1)
+			return errors.New("boom")
+		}},
+	})
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3 && atomic.LoadInt32(&failures) >= 3
+	}, time.Second, time.Millisecond)
+
+	stop()
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+
+	// Stopping twice is safe.
+	stop()
+}
+
+func TestStartSchedulerRunsRunOnStopJobsWhenStopped(t *testing.T) {
+	var runs int32
+	stop := startScheduler([]scheduledJob{
+		{Name: "flush", Interval: time.Hour, RunOnStop: true, Run: func() error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}},
+	})
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestListingExpiryDefaults(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+
+	appConfig.Listings.ExpiryDays = 0
+	appConfig.Listings.ReminderDays = 0
+	appConfig.Listings.SweepIntervalMinutes = 0
+	assert.Equal(t, 30*24*time.Hour, listingExpiryDuration())
+	assert.Equal(t, 3*24*time.Hour, listingReminderWindow())
+	assert.Equal(t, time.Hour, listingSweepInterval())
+
+	appConfig.Listings.ExpiryDays = 14
+	assert.Equal(t, 14*24*time.Hour, listingExpiryDuration())
+}
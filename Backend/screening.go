@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Screening verdicts, from least to most severe. Flagged listings are saved
+// and queued for moderators; rejected ones are not saved.
+const (
+	ScreenAllow  = "allow"
+	ScreenFlag   = "flag"
+	ScreenReject = "reject"
+)
+
+var screenSeverity = map[string]int{ScreenAllow: 0, ScreenFlag: 1, ScreenReject: 2}
+
+// listingContent is the seller-written text that is screened.
+type listingContent struct {
+	Name        string
+	Description string
+}
+
+func (c listingContent) text() string {
+	return c.Name + "\n" + c.Description
+}
+
+// screeningFinding is one screener's verdict and the reason shown to the seller.
+type screeningFinding struct {
+	Verdict string
+	Reason  string
+}
+
+// listingScreener is one check in the screening pipeline. It returns no
+// findings when the content is fine.
+type listingScreener interface {
+	screen(c listingContent) []screeningFinding
+}
+
+// ScreeningResult is the outcome of screening a listing. Reasons explain
+// the verdict and are empty when it is allow.
+type ScreeningResult struct {
+	Verdict string   `json:"verdict"`
+	Reasons []string `json:"reasons"`
+}
+
+// screeningPipeline runs every screener and keeps the most severe verdict.
+type screeningPipeline []listingScreener
+
+func (p screeningPipeline) run(c listingContent) ScreeningResult {
+	result := ScreeningResult{Verdict: ScreenAllow, Reasons: []string{}}
+	for _, s := range p {
+		for _, f := range s.screen(c) {
+			switch {
+			case screenSeverity[f.Verdict] > screenSeverity[result.Verdict]:
+				result = ScreeningResult{Verdict: f.Verdict, Reasons: []string{f.Reason}}
+			case f.Verdict == result.Verdict && f.Verdict != ScreenAllow:
+				result.Reasons = append(result.Reasons, f.Reason)
+			}
+		}
+	}
+	return result
+}
+
+// blocklistRule rejects or flags content matching a pattern.
+type blocklistRule struct {
+	pattern *regexp.Regexp
+	verdict string
+	reason  string
+}
+
+type blocklistScreener []blocklistRule
+
+func (b blocklistScreener) screen(c listingContent) []screeningFinding {
+	var findings []screeningFinding
+	text := c.text()
+	for _, rule := range b {
+		if rule.pattern.MatchString(text) {
+			findings = append(findings, screeningFinding{Verdict: rule.verdict, Reason: rule.reason})
+		}
+	}
+	return findings
+}
+
+// BlocklistRuleConfig is a blocklist entry in the screening section of
+// config.json. Pattern is a case-insensitive regular expression and Action
+// is reject or flag.
+type BlocklistRuleConfig struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason"`
+}
+
+// defaultBlocklist is used when config.json has no blocklist.
+var defaultBlocklist = []BlocklistRuleConfig{
+	{
+		Pattern: `\b(guns?|firearms?|pistols?|rifles?|shotguns?|handguns?|ammo|ammunition|tasers?|brass knuckles|switchblades?)\b`,
+		Action:  ScreenReject,
+		Reason:  "Weapons and ammunition cannot be sold on the marketplace",
+	},
+	{
+		Pattern: `\b(beer|vodka|whiske?y|tequila|rum|liquor|alcohol|booze)\b`,
+		Action:  ScreenFlag,
+		Reason:  "Listings that mention alcohol are reviewed by a moderator",
+	},
+	{
+		Pattern: `\bscalp(ing|ed|er)?\b|\btickets?\b.*\b(above|over) face( value)?\b`,
+		Action:  ScreenFlag,
+		Reason:  "Ticket resale above face value is reviewed by a moderator",
+	},
+}
+
+// compileBlocklist turns configured rules into a screener.
+func compileBlocklist(rules []BlocklistRuleConfig) (blocklistScreener, error) {
+	var b blocklistScreener
+	for i, rule := range rules {
+		if rule.Action != ScreenReject && rule.Action != ScreenFlag {
+			return nil, fmt.Errorf("blocklist rule %d: action must be reject or flag", i)
+		}
+		if rule.Reason == "" {
+			return nil, fmt.Errorf("blocklist rule %d: reason is required", i)
+		}
+		re, err := regexp.Compile("(?is)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist rule %d: %v", i, err)
+		}
+		b = append(b, blocklistRule{pattern: re, verdict: rule.Action, reason: rule.Reason})
+	}
+	return b, nil
+}
+
+var (
+	// phonePattern only matches numbers grouped like a phone number, so
+	// bare digit runs such as ISBN-10s are left alone.
+	phonePattern = regexp.MustCompile(`(?:\+?1[\s.-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`)
+	// notPhonePrefix matches text that, right before a phone-like match,
+	// shows it is part of an ISBN or a longer hyphenated number.
+	notPhonePrefix = regexp.MustCompile(`(?i)(\bISBN(-1[03])?:?\s*[\d-]*|\d-)$`)
+	emailPattern   = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	linkPattern    = regexp.MustCompile(`(?i)\bhttps?://\S+|\bwww\.\S+`)
+)
+
+// containsPhoneNumber reports whether text has a phone number in it.
+func containsPhoneNumber(text string) bool {
+	for _, m := range phonePattern.FindAllStringIndex(text, -1) {
+		if !notPhonePrefix.MatchString(text[:m[0]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// contactInfoScreener rejects phone numbers and email addresses so that
+// buyers and sellers stay in touch through the marketplace.
+type contactInfoScreener struct{}
+
+func (contactInfoScreener) screen(c listingContent) []screeningFinding {
+	var findings []screeningFinding
+	text := c.text()
+	if containsPhoneNumber(text) {
+		findings = append(findings, screeningFinding{ScreenReject, "Phone numbers are not allowed in listings; buyers can contact you through the marketplace"})
+	}
+	if emailPattern.MatchString(text) {
+		findings = append(findings, screeningFinding{ScreenReject, "Email addresses are not allowed in listings; buyers can contact you through the marketplace"})
+	}
+	return findings
+}
+
+// capsScreener flags text that is mostly capital letters. Short text is
+// left alone so that names like "IKEA" pass.
+type capsScreener struct {
+	minLetters int
+	maxRatio   float64
+}
+
+func (s capsScreener) screen(c listingContent) []screeningFinding {
+	var letters, upper int
+	for _, r := range c.text() {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= s.minLetters && float64(upper)/float64(letters) > s.maxRatio {
+		return []screeningFinding{{ScreenFlag, "Listings written mostly in capital letters are reviewed by a moderator"}}
+	}
+	return nil
+}
+
+// linkScreener rejects listings with more than maxLinks links.
+type linkScreener struct {
+	maxLinks int
+}
+
+func (s linkScreener) screen(c listingContent) []screeningFinding {
+	if n := len(linkPattern.FindAllString(c.text(), -1)); n > s.maxLinks {
+		return []screeningFinding{{ScreenReject, fmt.Sprintf("Listings may contain at most %d links", s.maxLinks)}}
+	}
+	return nil
+}
+
+// newScreeningPipeline builds the pipeline with the given blocklist.
+func newScreeningPipeline(blocklist []BlocklistRuleConfig) (screeningPipeline, error) {
+	b, err := compileBlocklist(blocklist)
+	if err != nil {
+		return nil, err
+	}
+	return screeningPipeline{
+		b,
+		contactInfoScreener{},
+		capsScreener{minLetters: 12, maxRatio: 0.7},
+		linkScreener{maxLinks: 2},
+	}, nil
+}
+
+// listingScreening is the pipeline used by the listing handlers. It starts
+// with the default blocklist; initListingScreening applies config.json.
+var listingScreening = func() screeningPipeline {
+	p, err := newScreeningPipeline(defaultBlocklist)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
+// initListingScreening builds the pipeline from the screening section of
+// config.json, falling back to the default blocklist.
+func initListingScreening() error {
+	blocklist := appConfig.Screening.Blocklist
+	if len(blocklist) == 0 {
+		blocklist = defaultBlocklist
+	}
+	p, err := newScreeningPipeline(blocklist)
+	if err != nil {
+		return err
+	}
+	listingScreening = p
+	return nil
+}
+
+// screenListingContent screens a listing's name and description.
+var screenListingContent = func(c listingContent) ScreeningResult {
+	return listingScreening.run(c)
+}
+
+// flagListingForReview queues a flagged listing for moderators as a report
+// with no reporter. A listing has at most one such report under review.
+var flagListingForReview = func(listingID int, reasons []string) {
+	_, err := db.Exec(
+		`INSERT INTO reports(listing_id, reason, note)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM reports WHERE listing_id = $1 AND reason = $2 AND status IN ('open', 'triaged'))`,
+		listingID, ReportScreening, strings.Join(reasons, "; "),
+	)
+	if err != nil {
+		log.Printf("Error queueing listing %d for review: %v", listingID, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScreeningPipeline(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     listingContent
+		wantVerdict string
+		wantReasons int
+	}{
+		{"Clean listing", listingContent{"IKEA desk lamp", "Barely used, pickup at Reitz Union."}, ScreenAllow, 0},
+		{"Weapon", listingContent{"Hunting rifle", "Comes with a case."}, ScreenReject, 1},
+		{"Alcohol", listingContent{"Mini fridge", "Fits a case of beer."}, ScreenFlag, 1},
+		{"Ticket scalping", listingContent{"Football tickets", "Selling 2 tickets, a bit over face value."}, ScreenFlag, 1},
+		{"Phone number", listingContent{"Desk", "Text me at (352) 555-0123"}, ScreenReject, 1},
+		{"Dotted phone number", listingContent{"Desk", "Call 352.555.0123"}, ScreenReject, 1},
+		{"ISBN-10", listingContent{"C textbook", "ISBN 0131103628, 2nd edition"}, ScreenAllow, 0},
+		{"ISBN-13", listingContent{"C textbook", "ISBN 978-0131103627"}, ScreenAllow, 0},
+		{"Hyphenated ISBN-13", listingContent{"C textbook", "ISBN-13: 978-013-110-3627"}, ScreenAllow, 0},
+		{"Grouped ISBN", listingContent{"C textbook", "ISBN 013 110 3628"}, ScreenAllow, 0},
+		{"Phone after ISBN", listingContent{"C textbook", "ISBN 978-0131103627. Text 352-555-0123"}, ScreenReject, 1},
+		{"Email address", listingContent{"Desk", "Email gator@ufl.edu for details"}, ScreenReject, 1},
+		{"Shouting", listingContent{"BRAND NEW TEXTBOOK", "MUST SELL TODAY"}, ScreenFlag, 1},
+		{"Short acronym", listingContent{"TI-84 calculator", "Works fine"}, ScreenAllow, 0},
+		{"Link spam", listingContent{"Desk", "See http://a.example and http://b.example and www.c.example"}, ScreenReject, 1},
+		{"Reject outranks flag", listingContent{"BEER AND AMMO FOR SALE", "Call 352-555-0123"}, ScreenReject, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := listingScreening.run(tt.content)
+			assert.Equal(t, tt.wantVerdict, result.Verdict)
+			assert.Len(t, result.Reasons, tt.wantReasons)
+		})
+	}
+}
+
+func TestCompileBlocklist(t *testing.T) {
+	b, err := compileBlocklist([]BlocklistRuleConfig{{Pattern: `\bvape\b`, Action: ScreenFlag, Reason: "Vapes are reviewed"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []screeningFinding{{ScreenFlag, "Vapes are reviewed"}}, b.screen(listingContent{Name: "VAPE pen"}))
+
+	_, err = compileBlocklist([]BlocklistRuleConfig{{Pattern: `(`, Action: ScreenReject, Reason: "Broken"}})
+	assert.Error(t, err)
+	_, err = compileBlocklist([]BlocklistRuleConfig{{Pattern: `vape`, Action: "ban", Reason: "Vapes"}})
+	assert.Error(t, err)
+	_, err = compileBlocklist([]BlocklistRuleConfig{{Pattern: `vape`, Action: ScreenReject}})
+	assert.Error(t, err)
+}
+
+func listingForm(t *testing.T, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	for k, v := range fields {
+		assert.NoError(t, wr.WriteField(k, v))
+	}
+	assert.NoError(t, wr.Close())
+	return &b, wr.FormDataContentType()
+}
+
+func TestListingsHandlerRejectsScreenedContent(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+	originalAttributes := getCategoryAttributes
+	getCategoryAttributes = func(slug string) ([]CategoryAttribute, error) { return nil, nil }
+	defer func() { getCategoryAttributes = originalAttributes }()
+
+	body, contentType := listingForm(t, map[string]string{
+		"draft":              "true",
+		"productName":        "Handgun",
+		"productDescription": "Email me at gator@ufl.edu",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/listings", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("userId", "1")
+	rr := httptest.NewRecorder()
+
+	listingsHandler(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Weapons and ammunition")
+	assert.Contains(t, rr.Body.String(), "Email addresses")
+	// Nothing is saved.
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEditListingHandlerScreening(t *testing.T) {
+	stubListingRevisions(t)
+	originalGetListing := getListing
+	originalFlag := flagListingForReview
+	defer func() {
+		getListing = originalGetListing
+		flagListingForReview = originalFlag
+	}()
+	getListing = func(listingID int) (Listing, error) {
+		return Listing{ID: listingID, UserID: 1, Status: StatusActive, ProductName: "Desk", ProductDescription: "Oak desk"}, nil
+	}
+	var flagged []string
+	flagListingForReview = func(listingID int, reasons []string) {
+		flagged = reasons
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer mockDB.Close()
+		originalDB := db
+		db = mockDB
+		defer func() { db = originalDB }()
+
+		body, contentType := listingForm(t, map[string]string{"listingId": "3", "productDescription": "Call 352-555-0123"})
+		req := httptest.NewRequest(http.MethodPut, "/listing/updateListing", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+
+		editListingHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Phone numbers")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Flag", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer mockDB.Close()
+		originalDB := db
+		db = mockDB
+		defer func() { db = originalDB }()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE listings SET product_name = \\$1, updated_at = \\$2 WHERE id = \\$3 AND user_id = \\$4").
+			WithArgs("Desk and whiskey glasses", sqlmock.AnyArg(), 3, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		body, contentType := listingForm(t, map[string]string{"listingId": "3", "productName": "Desk and whiskey glasses"})
+		req := httptest.NewRequest(http.MethodPut, "/listing/updateListing", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+
+		editListingHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Screening ScreeningResult `json:"screening"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, ScreenFlag, resp.Screening.Verdict)
+		assert.Equal(t, resp.Screening.Reasons, flagged)
+		assert.Contains(t, flagged[0], "alcohol")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SearchResult is a listing matched by a full-text search along with its
+// relevance and highlighted snippets.
+type SearchResult struct {
+	Listing
+	Rank                 float64 `json:"rank"`
+	HighlightName        string  `json:"highlightName"`
+	HighlightDescription string  `json:"highlightDescription"`
+}
+
+// headlineOptions wraps matched terms in <mark> tags for the frontend.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10"
+
+// searchSort orders search results by relevance, most relevant first.
+const searchSort = "relevance"
+
+// searchRankSQL is a result's relevance. It is computed in double precision
+// so that it survives the round trip through a cursor exactly.
+const searchRankSQL = "(ts_rank(l.search_vector, q)::double precision + CASE WHEN to_tsvector('simple', u.name) @@ sq THEN 0.5 ELSE 0 END)"
+
+// searchListingsHandler handles GET /listings/search?q= requests. It matches
+// the query against the listing's search_vector (product name and description)
+// and the seller's name, excluding the current user's own listings. Results
+// are paged with limit and cursor, most relevant first.
+func searchListingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserIDStr := r.Header.Get("userId")
+	if currentUserIDStr == "" {
+		http.Error(w, "Missing userId header", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(currentUserIDStr)
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Seller names are matched with the 'simple' configuration so that
+	// proper names are not stemmed; a name hit adds a fixed boost to the rank.
+	var lq listingQuery
+	text := lq.bind(q)
+	headline := lq.bind(headlineOptions)
+	lq.rank = searchRankSQL
+	lq.where("l.user_id <> $%d", currentUserID)
+	lq.where("l.status = ANY($%d)", pq.Array(publicListingStatuses))
+	lq.where("l.deleted_at IS NULL")
+	lq.where("l.hidden_at IS NULL")
+	lq.where("(l.search_vector @@ q OR to_tsvector('simple', u.name) @@ sq)")
+	if err := lq.paginate(searchSort, cursor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base := fmt.Sprintf(`SELECT %s, %s,
+		ts_headline('english', l.product_name, q, %s),
+		ts_headline('english', COALESCE(l.product_description, ''), q, %s)
+	%s,
+		websearch_to_tsquery('english', %s) q,
+		websearch_to_tsquery('simple', %s) sq`, listingColumns, lq.rank, headline, headline, listingFrom, text, text)
+	query, params := lq.build(base, limit+1)
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var s SearchResult
+		if err := scanListing(rows, &s.Listing, &s.Rank, &s.HighlightName, &s.HighlightDescription); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, s)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// One extra row was fetched to tell whether another page follows.
+	nextCursor := ""
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		c := cursorAfter(last.Listing, searchSort)
+		c.Rank = last.Rank
+		nextCursor = encodeCursor(c)
+	}
+	for i := range results {
+		results[i].Images = fetchListingImages(results[i].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":    results,
+		"nextCursor": nextCursor,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchListingsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		userID         string
+		expectedStatus int
+	}{
+		{"Wrong method", http.MethodPost, "/listings/search?q=desk", "1", http.StatusMethodNotAllowed},
+		{"Missing userId", http.MethodGet, "/listings/search?q=desk", "", http.StatusBadRequest},
+		{"Missing query", http.MethodGet, "/listings/search", "1", http.StatusBadRequest},
+		{"Blank query", http.MethodGet, "/listings/search?q=++", "1", http.StatusBadRequest},
+		{"Bad cursor", http.MethodGet, "/listings/search?q=desk&cursor=not-a-cursor", "1", http.StatusBadRequest},
+		{"Cursor from another sort", http.MethodGet, "/listings/search?q=desk&cursor=" + encodeCursor(listingCursor{Sort: "newest"}), "1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.userID != "" {
+				req.Header.Set("userId", tt.userID)
+			}
+			w := httptest.NewRecorder()
+
+			searchListingsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestSearchListingsHandlerPaginatesByRank(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	originalDB := db
+	db = mockDB
+	defer func() { db = originalDB }()
+
+	now := time.Now()
+	columns := []string{"id", "user_id", "name", "email", "phone", "product_name", "product_description", "price",
+		"category", "category_name", "status", "attributes", "created_at", "updated_at", "expires_at", "publish_at",
+		"pickup_location_id", "pickup_slug", "pickup_name", "pickup_lat", "pickup_lon", "tags", "rank", "highlight_name", "highlight_description"}
+	row := func(id int, rank float64) []driver.Value {
+		return []driver.Value{id, 2, "Seller", "s@ufl.edu", "", "Oak desk", "", "45.00", "furniture", "Furniture", StatusActive, []byte(`{}`),
+			now, now, now, nil, nil, "", "", nil, nil, "{}", rank, "Oak <mark>desk</mark>", ""}
+	}
+
+	// The second page starts after the cursor's (rank, id) and the extra
+	// row tells the handler that a third page follows.
+	cursor := encodeCursor(listingCursor{Sort: searchSort, Rank: 0.75, ID: 9})
+	mock.ExpectQuery(`ORDER BY \(ts_rank\(l.search_vector, q\)::double precision .*\) DESC, l.id DESC LIMIT 3`).
+		WithArgs("desk", headlineOptions, 1, sqlmock.AnyArg(), 0.75, 9).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(row(7, 0.75)...).AddRow(row(4, 0.5)...).AddRow(row(3, 0.25)...))
+	for _, id := range []int{7, 4} {
+		mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/listings/search?q=desk&limit=2&cursor="+cursor, nil)
+	req.Header.Set("userId", "1")
+	w := httptest.NewRecorder()
+
+	searchListingsHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Results    []SearchResult `json:"results"`
+		NextCursor string         `json:"nextCursor"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Results, 2)
+	assert.Equal(t, "Oak <mark>desk</mark>", body.Results[0].HighlightName)
+	next, err := decodeCursor(body.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, searchSort, next.Sort)
+	assert.Equal(t, 0.5, next.Rank)
+	assert.Equal(t, 4, next.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Similar listings paging.
+const (
+	defaultSimilarLimit = 6
+	maxSimilarLimit     = 20
+)
+
+// similarListingsSQL ranks active listings against the listing bound to $1,
+// leaving out the viewer's own listings ($2). Each candidate is scored on:
+//
+//   - category: 1 for the same category, 0.5 for a sibling under the same parent;
+//   - price: 1 for the same price, falling linearly to 0 at a difference
+//     equal to the source price;
+//   - text: ts_rank of the candidate's search_vector against any word of
+//     the source product name.
+//
+// Only listings that share the category, its parent or a name word are
+// considered, so the scan stays on indexed columns.
+var similarListingsSQL = fmt.Sprintf(`
+WITH src AS (
+	SELECT s.id, s.category, s.price, sc.parent_id,
+		NULLIF(replace(plainto_tsquery('english', s.product_name)::text, ' & ', ' | '), '')::tsquery AS terms
+	FROM listings s LEFT JOIN categories sc ON sc.slug = s.category
+	WHERE s.id = $1
+)
+SELECT %s,
+	2 * (CASE WHEN l.category = src.category THEN 1.0
+		WHEN c.parent_id IS NOT NULL AND c.parent_id = src.parent_id THEN 0.5
+		ELSE 0 END)
+	+ (1 - LEAST(ABS(l.price - src.price) / GREATEST(src.price, 1), 1))
+	+ 4 * COALESCE(ts_rank(l.search_vector, src.terms), 0) AS score
+%s, src
+WHERE l.id <> src.id
+	AND l.user_id <> $2
+	AND l.status = 'active'
+	AND l.deleted_at IS NULL
+	AND l.hidden_at IS NULL
+	AND (l.category = src.category OR c.parent_id = src.parent_id OR l.search_vector @@ src.terms)
+ORDER BY score DESC, l.created_at DESC, l.id DESC
+LIMIT $3`, listingColumns, listingFrom)
+
+// similarListingsHandler handles GET /listings/{id}/similar?limit= and
+// returns the active listings most like the given one, best match first.
+func similarListingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid listing id", http.StatusBadRequest)
+		return
+	}
+	currentUserID, err := strconv.Atoi(r.Header.Get("userId"))
+	if err != nil {
+		http.Error(w, "Invalid userId header", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSimilarLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxSimilarLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxSimilarLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	source, err := getListing(listingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if source.Status == StatusDraft && source.UserID != currentUserID {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(similarListingsSQL, listingID, currentUserID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	listings := []Listing{}
+	for rows.Next() {
+		var l Listing
+		var score float64
+		if err := scanListing(rows, &l, &score); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		l.Images = fetchListingImages(l.ID)
+		listings = append(listings, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"listings": listings,
+	})
+}
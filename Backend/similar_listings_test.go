@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimilarListingsSQL(t *testing.T) {
+	assert.Contains(t, similarListingsSQL, "l.user_id <> $2")
+	assert.Contains(t, similarListingsSQL, "l.status = 'active'")
+	assert.Contains(t, similarListingsSQL, "l.deleted_at IS NULL")
+	assert.Contains(t, similarListingsSQL, "ORDER BY score DESC")
+}
+
+func TestSimilarListingsHandler(t *testing.T) {
+	originalGetListing := getListing
+	defer func() { getListing = originalGetListing }()
+	getListing = func(listingID int) (Listing, error) {
+		switch listingID {
+		case 404:
+			return Listing{}, sql.ErrNoRows
+		case 6:
+			return Listing{ID: listingID, UserID: 2, Status: StatusDraft}, nil
+		}
+		return Listing{ID: listingID, UserID: 2, Status: StatusActive, Category: "furniture", Price: 40}, nil
+	}
+
+	t.Run("Found", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock DB: %v", err)
+		}
+		defer mockDB.Close()
+		originalDB := db
+		db = mockDB
+		defer func() { db = originalDB }()
+
+		now := time.Now()
+		columns := []string{"id", "user_id", "name", "email", "phone", "product_name", "product_description", "price",
+			"category", "category_name", "status", "attributes", "created_at", "updated_at", "expires_at", "publish_at",
+			"pickup_location_id", "pickup_slug", "pickup_name", "pickup_lat", "pickup_lon", "tags", "score"}
+		mock.ExpectQuery("WITH src AS").
+			WithArgs(5, 1, 3).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(8, 3, "Other", "o@ufl.edu", "", "Oak desk", "", 45.0, "furniture", "Furniture", StatusActive, []byte(`{}`), now, now, now, nil, nil, "", "", nil, nil, "{}", 2.9))
+		mock.ExpectQuery("SELECT id, image_data, content_type FROM listing_images WHERE listing_id = \\$1").
+			WithArgs(8).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "image_data", "content_type"}))
+
+		req := httptest.NewRequest(http.MethodGet, "/listings/5/similar?limit=3", nil)
+		req.SetPathValue("id", "5")
+		req.Header.Set("userId", "1")
+		rr := httptest.NewRecorder()
+		similarListingsHandler(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Listings []Listing `json:"listings"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Len(t, body.Listings, 1)
+		assert.Equal(t, 8, body.Listings[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	tests := []struct {
+		name           string
+		listingID      string
+		query          string
+		expectedStatus int
+	}{
+		{"missing listing", "404", "", http.StatusNotFound},
+		{"someone else's draft", "6", "", http.StatusNotFound},
+		{"invalid limit", "5", "?limit=50", http.StatusBadRequest},
+		{"invalid id", "abc", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/listings/"+tt.listingID+"/similar"+tt.query, nil)
+			req.SetPathValue("id", tt.listingID)
+			req.Header.Set("userId", "1")
+			rr := httptest.NewRecorder()
+			similarListingsHandler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
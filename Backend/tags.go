@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Tag limits.
+const (
+	maxListingTags         = 10
+	maxTagLength           = 30
+	defaultPopularTagLimit = 20
+	maxPopularTagLimit     = 100
+)
+
+// initTagsDB creates tags, which holds each distinct normalized tag once,
+// and listing_tags, which links listings to them.
+func initTagsDB() error {
+	tagsSchema := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS listing_tags (
+		listing_id INTEGER NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (listing_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_listing_tags_tag ON listing_tags (tag_id);`
+	if _, err := db.Exec(tagsSchema); err != nil {
+		return fmt.Errorf("error creating tags tables: %v", err)
+	}
+	return nil
+}
+
+// listingTagsSQL selects the sorted tag names of the listing aliased as l.
+const listingTagsSQL = "ARRAY(SELECT t.name FROM listing_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.listing_id = l.id ORDER BY t.name)"
+
+var (
+	tagSeparators = regexp.MustCompile(`[\s_]+`)
+	validTag      = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// normalizeTag lower-cases a tag and joins its words with hyphens, so
+// "Mini Fridge" and "mini-fridge" are the same tag.
+func normalizeTag(raw string) (string, error) {
+	tag := tagSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(raw)), "-")
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tag %q may only contain letters, digits, spaces and hyphens", raw)
+	}
+	if len(tag) > maxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", raw, maxTagLength)
+	}
+	return tag, nil
+}
+
+// parseTags reads the comma-separated tags values of a form, normalizes
+// them and drops duplicates. Blank entries are ignored, so an empty value
+// means no tags.
+func parseTags(values []string) ([]string, error) {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+			tag, err := normalizeTag(raw)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) > maxListingTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxListingTags)
+	}
+	return tags, nil
+}
+
+// parseTagsForm parses the tags field of a listing form. sent is false when
+// the form has no tags field.
+func parseTagsForm(form url.Values) (tags []string, sent bool, err error) {
+	values, sent := form["tags"]
+	if !sent {
+		return nil, false, nil
+	}
+	tags, err = parseTags(values)
+	return tags, true, err
+}
+
+// replaceListingTags sets a listing's tags as part of tx, creating tags
+// that do not exist yet.
+func replaceListingTags(tx *sql.Tx, listingID int, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM listing_tags WHERE listing_id = $1", listingID); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO tags(name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING", pq.Array(tags),
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		"INSERT INTO listing_tags(listing_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2)",
+		listingID, pq.Array(tags),
+	)
+	return err
+}
+
+// setListingTags sets a listing's tags in a transaction of its own.
+var setListingTags = func(listingID int, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceListingTags(tx, listingID, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TagCount is a tag and the number of visible listings using it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// getPopularTags returns the most used tags on active and reserved
+// listings, optionally only those starting with prefix.
+var getPopularTags = func(prefix string, limit int) ([]TagCount, error) {
+	rows, err := db.Query(
+		`SELECT t.name, COUNT(*) FROM tags t
+		JOIN listing_tags lt ON lt.tag_id = t.id
+		JOIN listings l ON l.id = lt.listing_id
+		WHERE l.status = ANY($1) AND l.deleted_at IS NULL AND t.name LIKE $2 || '%'
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC, t.name
+		LIMIT $3`,
+		pq.Array(publicListingStatuses), prefix, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+// popularTagsHandler handles GET /tags/popular?prefix=&limit= and returns
+// tag usage counts for autocomplete, most used first.
+func popularTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultPopularTagLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPopularTagLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPopularTagLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	// The prefix is normalized like a tag, so it only uses letters, digits
+	// and hyphens and needs no LIKE escaping.
+	prefix := strings.Trim(tagSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix"))), "-"), "-")
+	if prefix != "" && !validTag.MatchString(prefix) {
+		http.Error(w, "Invalid prefix", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := getPopularTags(prefix, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	valid := map[string]string{
+		"IKEA":          "ikea",
+		" Mini Fridge ": "mini-fridge",
+		"mini-fridge":   "mini-fridge",
+		"dorm_room":     "dorm-room",
+		"ti84":          "ti84",
+	}
+	for input, want := range valid {
+		got, err := normalizeTag(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "-dorm", "dorm-", "café", "a/b", strings.Repeat("x", maxTagLength+1)} {
+		_, err := normalizeTag(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags([]string{"Dorm, IKEA,,", "dorm", "mini fridge"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dorm", "ikea", "mini-fridge"}, tags)
+
+	tags, err = parseTags([]string{""})
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	_, err = parseTags([]string{"a,b,c,d,e,f,g,h,i,j,k"})
+	assert.Error(t, err)
+
+	_, sent, err := parseTagsForm(url.Values{"productName": {"Lamp"}})
+	assert.NoError(t, err)
+	assert.False(t, sent)
+}
+
+func TestListingQueryTags(t *testing.T) {
+	f, err := parseListingFilter(url.Values{"tag": {"Dorm", "mini fridge"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dorm", "mini-fridge"}, f.Tags)
+
+	q := &listingQuery{}
+	f.apply(q)
+	query, params := q.build("SELECT l.id FROM listings l", 0)
+
+	assert.Contains(t, query, "l.id IN (SELECT lt.listing_id FROM listing_tags lt JOIN tags t ON t.id = lt.tag_id WHERE t.name = $2) AND l.id IN (SELECT lt.listing_id FROM listing_tags lt JOIN tags t ON t.id = lt.tag_id WHERE t.name = $3)")
+	assert.Equal(t, "dorm", params[1])
+	assert.Equal(t, "mini-fridge", params[2])
+
+	_, err = parseListingFilter(url.Values{"tag": {"no/slashes"}})
+	assert.Error(t, err)
+}
+
+func TestListingFilterMatchesTags(t *testing.T) {
+	l := Listing{Status: StatusActive, Tags: []string{"dorm", "ikea"}}
+	assert.True(t, listingFilter{Tags: []string{"ikea"}}.matches(l, nil))
+	assert.False(t, listingFilter{Tags: []string{"ikea", "mini-fridge"}}.matches(l, nil))
+}
+
+func TestPopularTagsHandler(t *testing.T) {
+	original := getPopularTags
+	defer func() { getPopularTags = original }()
+
+	var gotPrefix string
+	var gotLimit int
+	getPopularTags = func(prefix string, limit int) ([]TagCount, error) {
+		gotPrefix, gotLimit = prefix, limit
+		return []TagCount{{Name: "mini-fridge", Count: 4}}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	popularTagsHandler(rr, httptest.NewRequest(http.MethodGet, "/tags/popular?prefix=Mini%20&limit=5", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "mini", gotPrefix)
+	assert.Equal(t, 5, gotLimit)
+	var tags []TagCount
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tags))
+	assert.Equal(t, []TagCount{{Name: "mini-fridge", Count: 4}}, tags)
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?prefix=50%25"} {
+		rr := httptest.NewRecorder()
+		popularTagsHandler(rr, httptest.NewRequest(http.MethodGet, "/tags/popular"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
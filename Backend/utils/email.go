@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gopkg.in/gomail.v2"
 )
@@ -50,3 +52,66 @@ var SendVerificationCode = func(to, code string) error {
 	}
 	return nil
 }
+
+// SendListingExpiryReminder tells a seller that one of their listings is about to expire.
+var SendListingExpiryReminder = func(to, productName string, expiresAt time.Time) error {
+	body := fmt.Sprintf(
+		"Your listing \"%s\" will expire on %s.\n\nRenew it from My Listings to keep it visible on UFMarketPlace.",
+		productName, expiresAt.Format("January 2, 2006"),
+	)
+	err := sendEmail(to, "Your UFMarketPlace listing is about to expire", body)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// SendPriceDropAlert tells a user that a listing they favorited got cheaper.
+// Prices are dollar amounts formatted with two decimals, e.g. "19.99".
+var SendPriceDropAlert = func(to, productName, oldPrice, newPrice string) error {
+	body := fmt.Sprintf(
+		"Good news! \"%s\", which you favorited, dropped from $%s to $%s.\n\nView it on UFMarketPlace before it's gone.",
+		productName, oldPrice, newPrice,
+	)
+	err := sendEmail(to, "Price drop on a listing you favorited", body)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// SavedSearchMatch is one listing that matched one of a user's saved searches.
+// Price is formatted with two decimals, e.g. "19.99".
+type SavedSearchMatch struct {
+	SearchName  string
+	ProductName string
+	Price       string
+}
+
+// SendSavedSearchMatch tells a user that a new listing matches one of their saved searches.
+var SendSavedSearchMatch = func(to, searchName, productName, price string) error {
+	body := fmt.Sprintf(
+		"A new listing matches your saved search \"%s\":\n\n%s - $%s\n\nView it on UFMarketPlace.",
+		searchName, productName, price,
+	)
+	err := sendEmail(to, "New match for your saved search", body)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// SendSavedSearchDigest sends a user the day's matches for their saved searches.
+var SendSavedSearchDigest = func(to string, matches []SavedSearchMatch) error {
+	var b strings.Builder
+	b.WriteString("New listings matching your saved searches:\n\n")
+	for _, m := range matches {
+		fmt.Fprintf(&b, "[%s] %s - $%s\n", m.SearchName, m.ProductName, m.Price)
+	}
+	b.WriteString("\nView them on UFMarketPlace.")
+	err := sendEmail(to, "Your daily saved search matches", b.String())
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
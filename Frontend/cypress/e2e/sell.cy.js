@@ -15,7 +15,7 @@ describe('Sell Component', () => {
 
   it('should display the listings header and empty state when no products exist', () => {
     // Mock empty response
-    cy.intercept('GET', '/api/listings', []).as('getEmptyListings');
+    cy.intercept('GET', '/api/listings', { listings: [], nextCursor: '' }).as('getEmptyListings');
     
     cy.contains('h2', 'My Listings').should('exist');
     cy.contains('p', 'No listings found. Create your first one!').should('exist');
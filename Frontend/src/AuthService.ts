@@ -37,8 +37,36 @@ export interface ProductResponse {
   userName: string;
   images: string[]; 
   phone: string;
-  address: string;
+  pickupLocation: PickupLocation | null;
+  tags: string[];
+  distanceKm?: number;
+  screening?: ScreeningResult;
+  duplicate?: DuplicateMatch;
+}
+
+export interface ScreeningResult {
+  verdict: 'allow' | 'flag' | 'reject';
+  reasons: string[];
+}
+
+export interface DuplicateMatch {
+  existingListingId: number;
+  sameSeller: boolean;
+  reasons: string[];
+  merged: boolean;
+}
+
+export interface PickupLocation {
+  id?: number;
+  slug?: string;
+  name?: string;
+  lat: number;
+  lon: number;
+}
 
+export interface ListingsPage {
+  listings: ProductResponse[];
+  nextCursor: string;
 }
 
 export interface UserProfile {
@@ -134,7 +162,7 @@ export const authService = {
       throw this.handleError(error);
     }
   }, 
-  async createProduct(productData: ProductRequest): Promise<ProductResponse[]> {
+  async createProduct(productData: ProductRequest): Promise<ProductResponse> {
     try {
       const formData = new FormData();
       formData.append('listingId', productData.id);
@@ -155,13 +183,13 @@ export const authService = {
         }
       };
 
-      const response = await api.post<ProductResponse[]>('/listings', formData, config);
+      const response = await api.post<ProductResponse>('/listings', formData, config);
       return response.data;
     } catch (error) {
       throw this.handleError(error);
     }
   },
-  async updateProduct(productData: ProductRequest): Promise<ProductResponse[]> {
+  async updateProduct(productData: ProductRequest): Promise<ListingsPage> {
     try {
       const formData = new FormData();
       
@@ -207,26 +235,26 @@ export const authService = {
       throw this.handleError(error);
     }
   },
-  async getListing(): Promise<ProductResponse[]> {
+  async getListing(cursor: string = ''): Promise<ListingsPage> {
     try {
 
-      const response = await api.get<ProductResponse[]>('/listings/user');
+      const response = await api.get<ListingsPage>('/listings/user', { params: cursor ? { cursor } : {} });
       return response.data;
     } catch (error) {
       throw this.handleError(error);
     }
   }
   ,
-  async getListingsByOtheruser(): Promise<ProductResponse[]> {
+  async getListingsByOtheruser(cursor: string = ''): Promise<ListingsPage> {
     try {
 
-      const response = await api.get<ProductResponse[]>('/listings');
+      const response = await api.get<ListingsPage>('/listings', { params: cursor ? { cursor } : {} });
       return response.data;
     } catch (error) {
       throw this.handleError(error);
     }
   },
-  async deleteListing(productId: string): Promise<any> {
+  async deleteListing(productId: string): Promise<ListingsPage> {
     try {
       const response = await api.delete<any>('/listing/deleteListing?listingId='+productId+'&userEmail='+getEmail());
       return this.getListing();
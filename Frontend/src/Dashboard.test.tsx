@@ -9,7 +9,9 @@ jest.mock("react-router-dom", () => ({
 
   jest.mock("./AuthService", () => ({
     authService: {
-        getListingsByOtheruser: jest.fn().mockResolvedValue([
+        getListingsByOtheruser: jest.fn().mockResolvedValue({
+          nextCursor: '',
+          listings: [
             {
               id: '1',
               productName: 'Product A',
@@ -30,7 +32,7 @@ jest.mock("react-router-dom", () => ({
               userName: 'User B',
               userEmail: 'userb@example.com'
             }
-          ]),
+          ]}),
     },
   }));
 
@@ -17,44 +17,51 @@ interface Product {
   userName: string;
   userEmail: string;
   phone: string;
-  address: string;
+  pickup: string;
 }
 
 const Dashboard: React.FC = () => {
   const [products, setProducts] = useState<Product[]>([]);
   const [filteredProducts, setFilteredProducts] = useState<Product[]>([]);
+  const [nextCursor, setNextCursor] = useState<string>("");
   const [selectedProduct, setSelectedProduct] = useState<Product | null>(null);
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [selectedCategory, setSelectedCategory] = useState<string>("all");
   const [priceRange, setPriceRange] = useState<number>(1000000);
 
-  useEffect(() => {
-    const fetchListings = async () => {
-      try {
-        const savedProducts = await authService.getListingsByOtheruser();
-        if (savedProducts) {
-          const updatedProducts: Product[] = savedProducts.map((prod) => ({
-            id: String(prod.id),
-            name: prod.productName,
-            description: prod.productDescription,
-            price: `${prod.price}$`,
-            category: prod.category,
-            images: prod.images.map(
-              (imgObj: any) =>
-                `data:${imgObj.contentType};base64,${imgObj.data}`
-            ),
-            userName: prod.userName,
-            userEmail: prod.userEmail,
-            phone: prod.phone,
-            address: prod.address,
-          }));
-          setProducts(updatedProducts);
-          setFilteredProducts(updatedProducts); // initially show all
-        }
-      } catch (error) {
-        console.error("Error fetching listings:", error);
+  // fetchListings loads one page of the feed and appends it, or replaces
+  // the products when no cursor is given.
+  const fetchListings = async (cursor: string = "") => {
+    try {
+      const page = await authService.getListingsByOtheruser(cursor);
+      if (page) {
+        const updatedProducts: Product[] = page.listings.map((prod) => ({
+          id: String(prod.id),
+          name: prod.productName,
+          description: prod.productDescription,
+          price: `${prod.price}$`,
+          category: prod.category,
+          images: prod.images.map(
+            (imgObj: any) =>
+              `data:${imgObj.contentType};base64,${imgObj.data}`
+          ),
+          userName: prod.userName,
+          userEmail: prod.userEmail,
+          phone: prod.phone,
+          pickup: prod.pickupLocation
+            ? prod.pickupLocation.name ||
+              `${prod.pickupLocation.lat.toFixed(4)}, ${prod.pickupLocation.lon.toFixed(4)}`
+            : "",
+        }));
+        setProducts((prev) => (cursor ? [...prev, ...updatedProducts] : updatedProducts));
+        setNextCursor(page.nextCursor);
       }
-    };
+    } catch (error) {
+      console.error("Error fetching listings:", error);
+    }
+  };
+
+  useEffect(() => {
     fetchListings();
   }, []);
 
@@ -177,6 +184,12 @@ const Dashboard: React.FC = () => {
           )}
         </div>
 
+        {nextCursor && (
+          <button className="load-more-btn" onClick={() => fetchListings(nextCursor)}>
+            Load more
+          </button>
+        )}
+
         {/* Modal */}
         <Modal
           isOpen={isModalOpen}
@@ -241,10 +254,12 @@ const Dashboard: React.FC = () => {
                           {selectedProduct.userEmail}
                         </a>
                       </p>
-                      <p className="seller-email">
-                        <span className="icon">🏠</span>
-                        {selectedProduct.address}
-                      </p>
+                      {selectedProduct.pickup && (
+                        <p className="seller-email">
+                          <span className="icon">📍</span>
+                          {selectedProduct.pickup}
+                        </p>
+                      )}
                     </div>
                   </div>
                 </div>
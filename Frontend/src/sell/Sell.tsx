@@ -21,6 +21,7 @@ interface Product {
 const Sell: React.FC = () => {
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [products, setProducts] = useState<Product[]>([]);
+  const [nextCursor, setNextCursor] = useState<string>("");
   const [productData, setProductData] = useState<{
     id?: string;
     name: string;
@@ -58,8 +59,9 @@ const Sell: React.FC = () => {
   useEffect(() => {
     const fetchListings = async () => {
       try {
-        const savedProducts = await authService.getListing();
-        console.log(savedProducts);
+        const page = await authService.getListing();
+        const savedProducts = page.listings;
+        setNextCursor(page.nextCursor);
         if (savedProducts.length == 0) {
           return;
         }
@@ -86,6 +88,26 @@ const Sell: React.FC = () => {
     fetchListings();
   }, []);
 
+  const loadMore = async () => {
+    try {
+      const page = await authService.getListing(nextCursor);
+      const moreProducts: Product[] = page.listings.map((prod) => ({
+        id: String(prod.id),
+        name: prod.productName,
+        description: prod.productDescription,
+        price: `${prod.price}$`,
+        category: prod.category,
+        images: prod.images.map(
+          (imgObj: any) => `data:${imgObj.contentType};base64,${imgObj.data}`
+        ),
+      }));
+      setProducts((prev) => [...prev, ...moreProducts]);
+      setNextCursor(page.nextCursor);
+    } catch (error) {
+      console.error("Error fetching listings:", error);
+    }
+  };
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
 
@@ -114,8 +136,9 @@ const Sell: React.FC = () => {
       };
 
       try {
-        const responseProducts: ProductResponse[] =
-          await authService.updateProduct(updateProductData);
+        const page = await authService.updateProduct(updateProductData);
+        const responseProducts: ProductResponse[] = page.listings;
+        setNextCursor(page.nextCursor);
         const updatedProducts: Product[] = responseProducts.map((prod) => ({
           id: String(prod.id),
           name: prod.productName,
@@ -146,9 +169,9 @@ const Sell: React.FC = () => {
           images: fileImages,
         };
 
-        const responseProducts = await authService.createProduct(newProduct);
+        const created = await authService.createProduct(newProduct);
 
-        const newProducts: Product[] = responseProducts.map((prod) => ({
+        const newProducts: Product[] = [created].map((prod) => ({
           id: String(prod.id),
           name: prod.productName,
           description: prod.productDescription,
@@ -159,7 +182,11 @@ const Sell: React.FC = () => {
           ),
         }));
 
-        setProducts(newProducts);
+        // A duplicate merged into an existing listing replaces its card.
+        setProducts((prev) => [
+          ...newProducts,
+          ...prev.filter((p) => p.id !== newProducts[0].id),
+        ]);
       } catch (error) {
         console.error("Error creating product:", error);
       }
@@ -179,7 +206,8 @@ const Sell: React.FC = () => {
   const handleDelete = async (productId: string) => {
     try {
       const res = await authService.deleteListing(productId);
-      const newProducts: Product[] = res.map((prod: any) => ({
+      setNextCursor(res.nextCursor);
+      const newProducts: Product[] = res.listings.map((prod: any) => ({
         id: String(prod.id),
         name: prod.productName,
         description: prod.productDescription,
@@ -303,6 +331,12 @@ const Sell: React.FC = () => {
         )}
       </div>
 
+      {nextCursor && (
+        <button className="load-more-btn" onClick={loadMore}>
+          Load more
+        </button>
+      )}
+
       <button
         className="floating-action-btn"
         onClick={() => setIsModalOpen(true)}